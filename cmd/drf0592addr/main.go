@@ -0,0 +1,88 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// drf0592addr lists DFR0592 boards and changes their I²C address.
+//
+//	drf0592addr                    list the boards
+//	drf0592addr -from 0x10 -to 0x11
+//
+// The new address is effective after a power cycle of the board, the tool
+// waits for it and checks the board answers at its new address.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"devices/drf0592"
+
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/host/v3"
+)
+
+func parseAddr(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 0, 7)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return uint16(v), nil
+}
+
+func mainImpl() error {
+	busName := flag.String("b", "", "I²C bus to use")
+	from := flag.String("from", "", "current address of the board")
+	to := flag.String("to", "", "new address of the board")
+	flag.Parse()
+
+	if _, err := host.Init(); err != nil {
+		return err
+	}
+	bus, err := i2creg.Open(*busName)
+	if err != nil {
+		return err
+	}
+	defer bus.Close()
+
+	if *from == "" && *to == "" {
+		addrs := drf0592.Detecte(bus)
+		if len(addrs) == 0 {
+			return fmt.Errorf("no board found on %s", bus)
+		}
+		for _, a := range addrs {
+			fmt.Printf("0x%02x\n", a)
+		}
+		return nil
+	}
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both -from and -to are required")
+	}
+	oldAddr, err := parseAddr(*from)
+	if err != nil {
+		return err
+	}
+	newAddr, err := parseAddr(*to)
+	if err != nil {
+		return err
+	}
+
+	powerCycle := func() error {
+		fmt.Printf("Address 0x%02x written. Power cycle the board then press Enter.\n", newAddr)
+		_, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		return err
+	}
+	if _, err := drf0592.ChangeAddress(bus, oldAddr, newAddr, powerCycle); err != nil {
+		return fmt.Errorf("board 0x%02x: %v", oldAddr, err)
+	}
+	fmt.Printf("Board now at 0x%02x\n", newAddr)
+	return nil
+}
+
+func main() {
+	if err := mainImpl(); err != nil {
+		fmt.Fprintf(os.Stderr, "drf0592addr: %s.\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,120 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// m5flash flashes the firmware of an STM32 based M5Stack unit over I²C.
+//
+//	m5flash -boot <bootloader addr> -app <flash addr> firmware.bin
+//	m5flash -unit 0x20 -boot <bootloader addr> -app <flash addr> firmware.bin
+//
+// With -unit, the tool first checks that an M5Stack unit answers at this
+// address and switches it to its bootloader by writing its JUMP_TO_BOOTLOADER
+// register.
+//
+// The bootloader of the units is not documented by M5Stack: the STM32F030 has
+// no I²C bootloader in ROM, so the register starts code stored by M5Stack at
+// the start of the flash. Its I²C address, the application address and its
+// protocol are open questions. The tool speaks the STM32 AN4221 protocol of
+// package devices/stm32boot, it has not been checked against a unit and
+// stops when the bootloader does not answer Get and Get ID as AN4221
+// describes. The first page of the flash is never written.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"devices/m5stack/unit"
+	"devices/stm32boot"
+
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/host/v3"
+)
+
+func parseAddr(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 0, 7)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return uint16(v), nil
+}
+
+func mainImpl() error {
+	busName := flag.String("b", "", "I²C bus to use")
+	unitAddr := flag.String("unit", "", "address of the unit to switch to its bootloader")
+	boot := flag.String("boot", "", "address of the bootloader")
+	app := flag.String("app", "", "flash address of the application")
+	pageSize := flag.Int("page", stm32boot.DefaultOpts.PageSize, "flash page size in bytes")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *boot == "" || *app == "" {
+		return fmt.Errorf("usage: m5flash [-b bus] [-unit addr] -boot addr -app addr firmware.bin")
+	}
+	image, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	opts := stm32boot.DefaultOpts
+	opts.PageSize = *pageSize
+	if opts.I2cAddress, err = parseAddr(*boot); err != nil {
+		return err
+	}
+	a, err := strconv.ParseUint(*app, 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid application address %q", *app)
+	}
+	opts.AppAddress = uint32(a)
+	opts.BootSize = opts.PageSize
+
+	if _, err := host.Init(); err != nil {
+		return err
+	}
+	bus, err := i2creg.Open(*busName)
+	if err != nil {
+		return err
+	}
+	defer bus.Close()
+
+	if *unitAddr != "" {
+		addr, err := parseAddr(*unitAddr)
+		if err != nil {
+			return err
+		}
+		info, err := unit.Probe(bus, addr)
+		if err != nil {
+			return err
+		}
+		fmt.Println(info)
+		if err := unit.New(bus, addr).JumpBootloader(); err != nil {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	dev, err := stm32boot.New(bus, &opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bootloader version 0x%02x, PID 0x%04x\n", dev.Version(), dev.PID())
+	progress := func(p stm32boot.Progress) {
+		fmt.Printf("\r%-6s %3d%%", p.Stage, 100*p.Done/p.Total)
+		if p.Done == p.Total {
+			fmt.Println()
+		}
+	}
+	if err := dev.Flash(image, progress); err != nil {
+		fmt.Println()
+		return err
+	}
+	fmt.Printf("%d bytes flashed at 0x%08x\n", len(image), opts.AppAddress)
+	return nil
+}
+
+func main() {
+	if err := mainImpl(); err != nil {
+		fmt.Fprintf(os.Stderr, "m5flash: %s.\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,151 @@
+package deverr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotDetected is returned when a device does not answer or does not
+	// identify as expected.
+	ErrNotDetected = errors.New("device not detected")
+	// ErrParameter is returned for out of range or invalid parameters.
+	ErrParameter = errors.New("invalid parameter")
+	// ErrVersion is returned when the device firmware is not supported.
+	ErrVersion = errors.New("unsupported firmware version")
+	// ErrDevice is returned when the device reports a failure.
+	ErrDevice = errors.New("device failure")
+	// ErrNotSupported is returned for operations the hardware cannot do.
+	ErrNotSupported = errors.New("not supported")
+	// ErrBus is matched by every *BusError.
+	ErrBus = errors.New("bus failure")
+)
+
+// BusError is a failed transaction on the bus.
+type BusError struct {
+	Addr uint16
+	Op   string
+	Err  error // error of the bus
+}
+
+func (e *BusError) Error() string {
+	return fmt.Sprintf("%s at 0x%02x: %v", e.Op, e.Addr, e.Err)
+}
+
+// Unwrap returns the error of the bus.
+func (e *BusError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrBus.
+func (e *BusError) Is(target error) bool {
+	return target == ErrBus
+}
+
+// Bus wraps the error of a transaction with the device at addr, nil stays nil.
+// Errors already wrapped are returned as is.
+func Bus(addr uint16, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var be *BusError
+	if errors.As(err, &be) {
+		return err
+	}
+	return &BusError{Addr: addr, Op: op, Err: err}
+}
+
+type paramError string
+
+func (e paramError) Error() string {
+	return string(e)
+}
+
+func (e paramError) Is(target error) bool {
+	return target == ErrParameter
+}
+
+// Paramf formats an error matching ErrParameter.
+func Paramf(format string, a ...interface{}) error {
+	return paramError(fmt.Sprintf(format, a...))
+}
+
+type notDetectedError struct {
+	addr uint16
+	err  error
+}
+
+func (e *notDetectedError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("%v at 0x%02x", ErrNotDetected, e.addr)
+	}
+	return fmt.Sprintf("%v at 0x%02x: %v", ErrNotDetected, e.addr, e.err)
+}
+
+// Unwrap returns the reason, so that a bus failure still matches ErrBus.
+func (e *notDetectedError) Unwrap() error {
+	return e.err
+}
+
+func (e *notDetectedError) Is(target error) bool {
+	return target == ErrNotDetected
+}
+
+// NotDetected returns an error matching ErrNotDetected for the device at addr.
+// err is the reason, it can be nil, errors.Is and errors.As also match it.
+func NotDetected(addr uint16, err error) error {
+	return &notDetectedError{addr: addr, err: err}
+}
+
+// Errors is a list of errors, like a failure and the failure of its recovery.
+// It matches errors.Is and errors.As when one of its errors does.
+type Errors []error
+
+// Append adds err to the list, nil errors are ignored and lists are flattened.
+func (e *Errors) Append(err error) {
+	if l, ok := err.(Errors); ok {
+		*e = append(*e, l...)
+	} else if err != nil {
+		*e = append(*e, err)
+	}
+}
+
+// Err returns nil for an empty list and the error itself for a single error.
+func (e Errors) Err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Is reports whether one of the errors matches target.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error matching target.
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
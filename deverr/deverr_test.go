@@ -0,0 +1,69 @@
+package deverr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	cause := errors.New("remote I/O error")
+	err := Bus(0x10, "read", cause)
+	if !errors.Is(err, ErrBus) || !errors.Is(err, cause) {
+		t.Errorf("%v does not match ErrBus and its cause", err)
+	}
+	var be *BusError
+	if wrapped := fmt.Errorf("MotorStop: %w", err); !errors.As(wrapped, &be) || be.Addr != 0x10 {
+		t.Errorf("errors.As(%v) failed", wrapped)
+	}
+	if w := fmt.Errorf("x: %w", err); Bus(0x11, "write", w) != w {
+		t.Errorf("wrapped BusError not kept")
+	}
+	if Bus(0x10, "read", nil) != nil {
+		t.Errorf("Bus(nil) != nil")
+	}
+	if err := Paramf("speed out of range: %d-%d", 0, 100); !errors.Is(err, ErrParameter) || err.Error() != "speed out of range: 0-100" {
+		t.Errorf("Paramf() = %v", err)
+	}
+	if err := NotDetected(0x29, nil); !errors.Is(err, ErrNotDetected) || errors.Is(err, ErrBus) {
+		t.Errorf("NotDetected() = %v", err)
+	}
+	err = NotDetected(0x29, Bus(0x29, "read", cause))
+	if !errors.Is(err, ErrNotDetected) || !errors.Is(err, ErrBus) || !errors.As(err, &be) || be.Addr != 0x29 {
+		t.Errorf("NotDetected() = %v does not match its reason", err)
+	}
+	if s := err.Error(); s != "device not detected at 0x29: read at 0x29: remote I/O error" {
+		t.Errorf("Error() = %q", s)
+	}
+}
+
+func TestErrors_list(t *testing.T) {
+	var errs Errors
+	if errs.Err() != nil {
+		t.Errorf("empty list Err() = %v", errs.Err())
+	}
+	cause := errors.New("remote I/O error")
+	errs.Append(Paramf("speed"))
+	errs.Append(nil)
+	if err := errs.Err(); !errors.Is(err, ErrParameter) || len(errs) != 1 {
+		t.Errorf("single error Err() = %v", err)
+	}
+	errs.Append(Bus(0x40, "stop", cause))
+	err := fmt.Errorf("MotorMovement: %w", errs.Err())
+	var be *BusError
+	if !errors.Is(err, ErrParameter) || !errors.Is(err, cause) || !errors.As(err, &be) || be.Op != "stop" {
+		t.Errorf("%v does not match its errors", err)
+	}
+	if errors.Is(err, ErrVersion) {
+		t.Errorf("%v matches ErrVersion", err)
+	}
+	if s := errs.Error(); s != "speed; stop at 0x40: remote I/O error" {
+		t.Errorf("Error() = %q", s)
+	}
+	var all Errors
+	all.Append(cause)
+	all.Append(errs)
+	if len(all) != 3 {
+		t.Errorf("Append() of a list = %d errors, want 3", len(all))
+	}
+}
@@ -0,0 +1,16 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package deverr defines the errors shared by the drivers of this module.
+//
+// Errors returned by the drivers match the sentinels with errors.Is, so that
+// callers can react to a missing device, a bad parameter or a bus failure
+// whatever the driver:
+//
+//	if errors.Is(err, deverr.ErrBus) {
+//		// retry or reset the bus
+//	}
+//
+// Bus failures are *BusError values, errors.As gives the address and the
+// error of the underlying bus.
+package deverr
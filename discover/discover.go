@@ -0,0 +1,282 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+
+	"devices/drf0592"
+	"devices/m5stack/ext_encoder"
+	"devices/m5stack/hbridge"
+	"devices/m5stack/rfid2_unit"
+	"devices/m5stack/servo_unit"
+	"devices/m5stack/ultrasonic"
+	"devices/m5stack/unit"
+	"devices/tcs3472"
+	"devices/vl53l0x"
+	"devices/ws15364"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+// First and last addresses scanned, the others are reserved.
+const (
+	FIRST_ADDR = 0x03
+	LAST_ADDR  = 0x77
+)
+
+// Kind is the type of a device found on the bus.
+type Kind int
+
+const (
+	KIND_UNKNOWN Kind = iota
+	KIND_DRF0592
+	KIND_WS15364
+	KIND_TCS3472
+	KIND_VL53L0X
+	KIND_RFID2_UNIT
+	KIND_HBRIDGE
+	KIND_SERVO_UNIT
+	KIND_EXT_ENCODER
+	KIND_M5_UNIT // M5Stack unit away from its default address
+	KIND_ULTRASONIC
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KIND_UNKNOWN:
+		return "unknown"
+	case KIND_DRF0592:
+		return "drf0592"
+	case KIND_WS15364:
+		return "ws15364"
+	case KIND_TCS3472:
+		return "tcs3472"
+	case KIND_VL53L0X:
+		return "vl53l0x"
+	case KIND_RFID2_UNIT:
+		return "rfid2_unit"
+	case KIND_HBRIDGE:
+		return "hbridge"
+	case KIND_SERVO_UNIT:
+		return "servo_unit"
+	case KIND_EXT_ENCODER:
+		return "ext_encoder"
+	case KIND_M5_UNIT:
+		return "m5stack unit"
+	case KIND_ULTRASONIC:
+		return "ultrasonic"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Device is a device found on the bus.
+//
+// Opts are the options to pass to New of the driver, set to the address of
+// the device: *drf0592.Opts, *ws15364.Opts, *tcs3472.Opts, *vl53l0x.Opts,
+// *rfid2_unit.Opts, *hbridge.Opts, *servo_unit.Opts, *ext_encoder.Opts or
+// *ultrasonic.Opts. They are nil for KIND_UNKNOWN and KIND_M5_UNIT.
+type Device struct {
+	Addr   uint16
+	Kind   Kind
+	Detail string // model or firmware version
+	Opts   interface{}
+}
+
+func (d Device) String() string {
+	if d.Detail == "" {
+		return fmt.Sprintf("0x%02x %s", d.Addr, d.Kind)
+	}
+	return fmt.Sprintf("0x%02x %s (%s)", d.Addr, d.Kind, d.Detail)
+}
+
+// Scan identifies every device answering on bus. The LED All Call address of
+// a PCA9685 found at a lower address is left out.
+func Scan(bus i2c.Bus) []Device {
+	var found []Device
+	allCall := map[uint16]bool{}
+	for addr := uint16(FIRST_ADDR); addr <= LAST_ADDR; addr++ {
+		d, ok := Identify(bus, addr)
+		if !ok {
+			continue
+		}
+		if d.Kind == KIND_WS15364 {
+			if allCall[addr] {
+				continue
+			}
+			if a, ok := allCallAddr(i2c.Dev{Bus: bus, Addr: addr}); ok {
+				allCall[a] = true
+			}
+		}
+		found = append(found, d)
+	}
+	return found
+}
+
+// Identify identifies the device at addr, it returns false when no device
+// answers.
+func Identify(bus i2c.Bus, addr uint16) (Device, bool) {
+	c := i2c.Dev{Bus: bus, Addr: addr}
+	if err := c.Tx(nil, make([]byte, 1)); err != nil {
+		return Device{}, false
+	}
+	d := Device{Addr: addr}
+	for _, probe := range probes {
+		if probe(c, &d) {
+			return d, true
+		}
+	}
+	return d, true
+}
+
+// probes are tried in order, they fill d and return true when the device at
+// c.Addr is theirs. The ultrasonic unit comes first, the register reads of
+// the other probes are commands for it.
+var probes = []func(c i2c.Dev, d *Device) bool{
+	probeUltrasonic,
+	probeDRF0592,
+	probeVL53L0X,
+	probeTCS3472,
+	probeRFID2,
+	probePCA9685,
+	probeM5Unit,
+}
+
+func readReg(c i2c.Dev, reg byte) (byte, bool) {
+	r := make([]byte, 1)
+	if err := c.Tx([]byte{reg}, r); err != nil {
+		return 0, false
+	}
+	return r[0], true
+}
+
+func probeUltrasonic(c i2c.Dev, d *Device) bool {
+	if c.Addr != ultrasonic.I2CAddr {
+		return false
+	}
+	dev, err := ultrasonic.New(c.Bus, &ultrasonic.DefaultOpts)
+	if err != nil {
+		return false
+	}
+	if _, err := dev.GetDistance(); err != nil {
+		return false
+	}
+	// The AT24C32 EEPROM of RTC modules also answers at 0x57, it reads its
+	// memory from a 2 byte pointer while the sensor returns its last
+	// measurement whatever was written before the read. Blank memory reads
+	// the same at any pointer, its values are not taken as measurements.
+	a, b := make([]byte, 3), make([]byte, 3)
+	if c.Tx([]byte{0x00, 0x00}, a) != nil || c.Tx([]byte{0x00, 0x01}, b) != nil || !bytes.Equal(a, b) {
+		return false
+	}
+	if bytes.Equal(a, []byte{0x00, 0x00, 0x00}) || bytes.Equal(a, []byte{0xFF, 0xFF, 0xFF}) {
+		return false
+	}
+	opts := ultrasonic.DefaultOpts
+	d.Kind, d.Detail, d.Opts = KIND_ULTRASONIC, "RCWL-9620", &opts
+	return true
+}
+
+func probeDRF0592(c i2c.Dev, d *Device) bool {
+	if drf0592.Probe(c.Bus, c.Addr) != nil {
+		return false
+	}
+	opts := drf0592.DefaultOpts
+	opts.I2cAddress = c.Addr
+	d.Kind, d.Opts = KIND_DRF0592, &opts
+	return true
+}
+
+func probeVL53L0X(c i2c.Dev, d *Device) bool {
+	if id, ok := readReg(c, vl53l0x.IDENTIFICATION_MODEL_ID); !ok || id != vl53l0x.VL53L0X_MODEL_ID {
+		return false
+	}
+	opts := vl53l0x.DefaultOpts
+	opts.I2cAddress = c.Addr
+	d.Kind, d.Opts = KIND_VL53L0X, &opts
+	return true
+}
+
+func probeTCS3472(c i2c.Dev, d *Device) bool {
+	id, ok := readReg(c, tcs3472.TCS34725_COMMAND_BIT|tcs3472.TCS3472_ID)
+	switch {
+	case !ok:
+		return false
+	case id == 0x44:
+		d.Detail = "TCS34721/TCS34725"
+	case id == 0x4D:
+		d.Detail = "TCS34723/TCS34727"
+	default:
+		return false
+	}
+	opts := tcs3472.DefaultOpts
+	opts.I2cAddress = c.Addr
+	d.Kind, d.Opts = KIND_TCS3472, &opts
+	return true
+}
+
+func probeRFID2(c i2c.Dev, d *Device) bool {
+	v, ok := readReg(c, rfid2_unit.VERSION_REG)
+	switch {
+	case !ok:
+		return false
+	case v == 0x15:
+		d.Detail = "WS1850S"
+	case v == 0x91 || v == 0x92:
+		d.Detail = fmt.Sprintf("MFRC522 v%d", v&0x0F)
+	default:
+		return false
+	}
+	opts := rfid2_unit.DefaultOpts
+	opts.I2cAddress = c.Addr
+	d.Kind, d.Opts = KIND_RFID2_UNIT, &opts
+	return true
+}
+
+func probePCA9685(c i2c.Dev, d *Device) bool {
+	// SUBADR1 to SUBADR3 and ALLCALLADR power on values
+	for i, want := range []byte{0xE2, 0xE4, 0xE8, 0xE0} {
+		if v, ok := readReg(c, byte(0x02+i)); !ok || v != want {
+			return false
+		}
+	}
+	opts := ws15364.DefaultOpts
+	opts.I2cAddress = c.Addr
+	d.Kind, d.Detail, d.Opts = KIND_WS15364, "PCA9685", &opts
+	return true
+}
+
+// allCallAddr returns the LED All Call address the PCA9685 at c.Addr also
+// answers at, while the ALLCALL bit of MODE1 is set.
+func allCallAddr(c i2c.Dev) (uint16, bool) {
+	mode, ok := readReg(c, 0x00)
+	if !ok || mode&0x01 == 0 {
+		return 0, false
+	}
+	a, ok := readReg(c, 0x05)
+	if !ok {
+		return 0, false
+	}
+	return uint16(a >> 1), true
+}
+
+func probeM5Unit(c i2c.Dev, d *Device) bool {
+	info, err := unit.Probe(c.Bus, c.Addr)
+	if err != nil {
+		return false
+	}
+	d.Detail = fmt.Sprintf("firmware %d", info.FirmwareVersion)
+	switch c.Addr {
+	case hbridge.I2CAddr:
+		opts := hbridge.DefaultOpts
+		d.Kind, d.Opts = KIND_HBRIDGE, &opts
+	case servo_unit.I2CAddr:
+		opts := servo_unit.DefaultOpts
+		d.Kind, d.Opts = KIND_SERVO_UNIT, &opts
+	case ext_encoder.I2CAddr:
+		opts := ext_encoder.DefaultOpts
+		d.Kind, d.Opts = KIND_EXT_ENCODER, &opts
+	default:
+		d.Kind = KIND_M5_UNIT
+	}
+	return true
+}
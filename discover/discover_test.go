@@ -0,0 +1,142 @@
+package discover
+
+import (
+	"bytes"
+	"testing"
+
+	"devices/drf0592"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+	"devices/m5stack/hbridge"
+	"devices/m5stack/ultrasonic"
+	"devices/tcs3472"
+	"devices/ws15364"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+func TestScan(t *testing.T) {
+	b := i2cemu.NewBus()
+	sim.NewDFR0592().Attach(b, 0x10)
+	sim.NewHBridge(2).Attach(b, 0x20)
+	sim.NewServoUnit(3).Attach(b, 0x25)
+	sim.NewHBridge(2).Attach(b, 0x30)
+	sim.NewExtEncoder(1).Attach(b, 0x59)
+	b.Attach(0x29, sim.NewTCS3472())
+	pca := sim.NewPCA9685()
+	b.Attach(0x40, pca)
+	b.Attach(0x70, pca)
+	b.Attach(0x57, sim.NewRCWL9620(200*physic.MilliMetre))
+	vl := i2cemu.NewRegisterFile()
+	vl.Set(0xC0, 0xEE)
+	b.Attach(0x2A, vl)
+	rfid := i2cemu.NewRegisterFile()
+	rfid.Set(0x37, 0x15)
+	b.Attach(0x28, rfid)
+	b.Attach(0x50, i2cemu.NewRegisterFile())
+
+	want := []struct {
+		addr uint16
+		kind Kind
+	}{
+		{0x10, KIND_DRF0592},
+		{0x20, KIND_HBRIDGE},
+		{0x25, KIND_SERVO_UNIT},
+		{0x28, KIND_RFID2_UNIT},
+		{0x29, KIND_TCS3472},
+		{0x2A, KIND_VL53L0X},
+		{0x30, KIND_M5_UNIT},
+		{0x40, KIND_WS15364},
+		{0x50, KIND_UNKNOWN},
+		{0x57, KIND_ULTRASONIC},
+		{0x59, KIND_EXT_ENCODER},
+	}
+	found := Scan(b)
+	if len(found) != len(want) {
+		t.Fatalf("Scan() = %v", found)
+	}
+	for i, w := range want {
+		if found[i].Addr != w.addr || found[i].Kind != w.kind {
+			t.Errorf("found %s, want 0x%02x %s", found[i], w.addr, w.kind)
+		}
+	}
+
+	if o, ok := found[0].Opts.(*drf0592.Opts); !ok || o.I2cAddress != 0x10 {
+		t.Errorf("DRF0592 Opts = %#v", found[0].Opts)
+	}
+	if o, ok := found[1].Opts.(*hbridge.Opts); !ok || o.I2cAddress != hbridge.I2CAddr {
+		t.Errorf("hbridge Opts = %#v", found[1].Opts)
+	}
+	if found[1].Detail != "firmware 2" {
+		t.Errorf("hbridge Detail = %q", found[1].Detail)
+	}
+	if o, ok := found[4].Opts.(*tcs3472.Opts); !ok || o.Gain != tcs3472.DefaultOpts.Gain {
+		t.Errorf("TCS3472 Opts = %#v", found[4].Opts)
+	}
+	if found[6].Opts != nil {
+		t.Errorf("moved unit Opts = %#v", found[6].Opts)
+	}
+	if o, ok := found[7].Opts.(*ws15364.Opts); !ok || o.I2cAddress != 0x40 {
+		t.Errorf("WS15364 Opts = %#v", found[7].Opts)
+	}
+	if _, ok := found[9].Opts.(*ultrasonic.Opts); !ok {
+		t.Errorf("ultrasonic Opts = %#v", found[9].Opts)
+	}
+	if _, ok := Identify(b, 0x11); ok {
+		t.Errorf("Identify() of an empty address")
+	}
+	if d, ok := Identify(b, 0x70); !ok || d.Kind != KIND_WS15364 {
+		t.Errorf("Identify() of the All Call address = %s", d)
+	}
+}
+
+func TestScan_allCall(t *testing.T) {
+	// a single PCA9685 strapped at its All Call address
+	b := i2cemu.NewBus()
+	b.Attach(0x70, sim.NewPCA9685())
+	if found := Scan(b); len(found) != 1 || found[0].Addr != 0x70 || found[0].Kind != KIND_WS15364 {
+		t.Errorf("Scan() = %v", found)
+	}
+}
+
+// newAT24C32 emulates the EEPROM of RTC modules: a 2 byte pointer followed by
+// sequential reads.
+func newAT24C32(mem []byte) i2cemu.Device {
+	var ptr int
+	return i2cemu.DeviceFunc(func(w, r []byte) error {
+		if len(w) >= 2 {
+			ptr = (int(w[0])<<8 | int(w[1])) % len(mem)
+		}
+		for i := range r {
+			r[i] = mem[ptr]
+			ptr = (ptr + 1) % len(mem)
+		}
+		return nil
+	})
+}
+
+func TestScan_ultrasonic(t *testing.T) {
+	for _, fill := range []byte{0xFF, 0x00} {
+		mem := bytes.Repeat([]byte{fill}, 4096)
+		b := i2cemu.NewBus()
+		b.Attach(0x57, newAT24C32(mem))
+		if found := Scan(b); len(found) != 1 || found[0].Kind != KIND_UNKNOWN {
+			t.Errorf("Scan() of an EEPROM filled with 0x%02x = %v", fill, found)
+		}
+	}
+	// content reading as 12mm
+	mem := make([]byte, 4096)
+	copy(mem, []byte{0x00, 0x2F, 0x00, 0x30, 0x39})
+	b := i2cemu.NewBus()
+	b.Attach(0x57, newAT24C32(mem))
+	if found := Scan(b); len(found) != 1 || found[0].Kind != KIND_UNKNOWN {
+		t.Errorf("Scan() of an EEPROM = %v", found)
+	}
+
+	// nothing within range of the sensor
+	b = i2cemu.NewBus()
+	b.Attach(0x57, sim.NewRCWL9620(10000*physic.MilliMetre))
+	if found := Scan(b); len(found) != 1 || found[0].Kind != KIND_ULTRASONIC {
+		t.Errorf("Scan() of a sensor out of range = %v", found)
+	}
+}
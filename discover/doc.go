@@ -0,0 +1,29 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package discover scans an I²C bus and identifies the devices supported by
+// the drivers of this module:
+//
+//	DFR0592      PID and VID registers
+//	VL53L0X      model ID register (0xEE)
+//	TCS3472      ID register (0x44 or 0x4D)
+//	RFID2 unit   version register (0x15 for the WS1850S, 0x91/0x92 for MFRC522)
+//	WS15364      PCA9685 sub addresses and LED All Call address at their
+//	             power on values
+//	M5Stack unit address register holding the address of the unit, the kind
+//	             is given by the default address: hbridge, servo_unit or
+//	             ext_encoder
+//	RCWL-9620    at 0x57, a measurement read back unchanged whatever register
+//	             pointer is written, the M5Stack ultrasonic unit
+//
+// Identification only reads registers, except at 0x57 where a measurement is
+// started. An AT24C32 EEPROM at 0x57, found on RTC modules, reads its memory
+// from the pointer written and is told apart from the sensor, unless its
+// first 4 bytes hold the same value other than 0x00 and 0xFF. A sensor
+// reading 0 or 0xFFFFFF µm, the values of blank memory, is reported as
+// unknown.
+//
+// Every PCA9685 also answers at its LED All Call address, 0x70 by default.
+// Scan leaves it out when the PCA9685 was found at a lower address, a PCA9685
+// strapped at 0x70 alone is reported.
+package discover
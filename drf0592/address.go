@@ -0,0 +1,77 @@
+package drf0592
+
+import (
+	"fmt"
+	"time"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+// ProbeTimeout is how long ChangeAddress waits for the board to answer at its
+// new address after the power cycle.
+var ProbeTimeout = 2 * time.Second
+
+// ChangeAddress moves the board at from to to and returns a Dev to drive it.
+//
+// from may be any address Detecte scans, 0x01 to 0x7F, so that a board out of
+// the range of New can be brought back. to is limited to MIN_ADDR..MAX_ADDR,
+// the addresses New accepts, although the board stores any address from 1 to
+// 127: a board moved above MAX_ADDR could not be opened.
+//
+// The target address must be free on the bus. Motors are stopped, the
+// address is written and powerCycle is called: it must return once the board
+// has been switched off and on again, for example after prompting the user.
+// The board is then probed at its new address.
+func ChangeAddress(bus i2c.Bus, from, to uint16, powerCycle func() error) (*Dev, error) {
+	if from < 0x01 || from > 0x7F {
+		return nil, deverr.Paramf("invalid device address 0x%02x", from)
+	}
+	if to < MIN_ADDR || to > MAX_ADDR {
+		return nil, deverr.Paramf("invalid device address 0x%02x", to)
+	}
+	if to == from {
+		return nil, deverr.Paramf("board already at 0x%02x", to)
+	}
+	if checkBoard(bus, to) {
+		return nil, deverr.Paramf("another board answers at 0x%02x", to)
+	}
+	if err := bus.Tx(to, nil, make([]byte, 1)); err == nil {
+		return nil, deverr.Paramf("another device answers at 0x%02x", to)
+	}
+	if err := probeBoard(bus, from); err != nil {
+		return nil, err
+	}
+
+	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: from}}
+	for _, id := range []MotorId{M1, M2} {
+		if err := dev.MotorStop(id); err != nil {
+			return nil, err
+		}
+	}
+	if err := dev.SetAddr(byte(to)); err != nil {
+		return nil, err
+	}
+	if err := powerCycle(); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(ProbeTimeout)
+	for !checkBoard(bus, to) {
+		if time.Now().After(deadline) {
+			if checkBoard(bus, from) {
+				return nil, deverr.NotDetected(to, fmt.Errorf("board still at 0x%02x, address not changed", from))
+			}
+			return nil, deverr.NotDetected(to, fmt.Errorf("no answer after power cycle"))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return New(bus, &Opts{I2cAddress: to})
+}
+
+// ChangeAddress moves the board to addr, see the ChangeAddress function. dev
+// must not be used afterward.
+func (dev *Dev) ChangeAddress(addr uint16, powerCycle func() error) (*Dev, error) {
+	return ChangeAddress(dev.c.Bus, dev.c.Addr, addr, powerCycle)
+}
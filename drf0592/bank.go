@@ -0,0 +1,166 @@
+package drf0592
+
+import (
+	"fmt"
+	"sort"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+// MotorRef identifies a motor of a board in a Bank.
+type MotorRef struct {
+	Addr uint16
+	Id   MotorId
+}
+
+// MotorCommand is the movement of one motor, see MotorMovement.
+type MotorCommand struct {
+	Direction Direction
+	Speed     float32
+}
+
+// Bank drives the motors of several boards stacked on the same bus by name.
+type Bank struct {
+	devs   map[uint16]*Dev
+	motors map[string]MotorRef
+}
+
+// NewBank opens every board found from MIN_ADDR to MAX_ADDR, the addresses
+// accepted by New. Boards above MAX_ADDR are left out, the ChangeAddress
+// function moves them into the range.
+func NewBank(bus i2c.Bus) (*Bank, error) {
+	b := &Bank{devs: map[uint16]*Dev{}, motors: map[string]MotorRef{}}
+	for a := uint16(MIN_ADDR); a <= MAX_ADDR; a++ {
+		if !checkBoard(bus, a) {
+			continue
+		}
+		dev, err := New(bus, &Opts{I2cAddress: a})
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		b.devs[a] = dev
+	}
+	if len(b.devs) == 0 {
+		return nil, deverr.ErrNotDetected
+	}
+	return b, nil
+}
+
+// Addrs returns the addresses of the boards, in increasing order.
+func (b *Bank) Addrs() []uint16 {
+	addrs := make([]uint16, 0, len(b.devs))
+	for a := range b.devs {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// Dev returns the board at addr, nil if it is not in the bank.
+func (b *Bank) Dev(addr uint16) *Dev {
+	return b.devs[addr]
+}
+
+// Assign names motor id of the board at addr.
+func (b *Bank) Assign(name string, addr uint16, id MotorId) error {
+	if _, ok := b.devs[addr]; !ok {
+		return deverr.Paramf("no board at 0x%02x", addr)
+	}
+	if err := checkId(id); err != nil {
+		return err
+	}
+	if _, ok := b.motors[name]; ok {
+		return deverr.Paramf("motor %q already assigned", name)
+	}
+	ref := MotorRef{Addr: addr, Id: id}
+	for n, r := range b.motors {
+		if r == ref {
+			return deverr.Paramf("motor %d of board 0x%02x already named %q", id, addr, n)
+		}
+	}
+	b.motors[name] = ref
+	return nil
+}
+
+// Names returns the motor names, sorted.
+func (b *Bank) Names() []string {
+	names := make([]string, 0, len(b.motors))
+	for n := range b.motors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Motor returns the board and motor id of a named motor.
+func (b *Bank) Motor(name string) (*Dev, MotorId, error) {
+	ref, ok := b.motors[name]
+	if !ok {
+		return nil, 0, deverr.Paramf("unknown motor %q", name)
+	}
+	return b.devs[ref.Addr], ref.Id, nil
+}
+
+// Set moves a named motor.
+func (b *Bank) Set(name string, direction Direction, speed float32) error {
+	dev, id, err := b.Motor(name)
+	if err != nil {
+		return err
+	}
+	return dev.MotorMovement(id, direction, speed)
+}
+
+// Stop stops a named motor.
+func (b *Bank) Stop(name string) error {
+	dev, id, err := b.Motor(name)
+	if err != nil {
+		return err
+	}
+	return dev.MotorStop(id)
+}
+
+// SetAll moves several named motors with one call. All the commands are
+// checked before any motor is moved and every motor of the bank is stopped
+// if one of them fails.
+func (b *Bank) SetAll(cmds map[string]MotorCommand) error {
+	for name, c := range cmds {
+		if _, ok := b.motors[name]; !ok {
+			return deverr.Paramf("unknown motor %q", name)
+		}
+		if c.Direction != CW && c.Direction != CCW {
+			return deverr.Paramf("motor %q: wrong direction parameter", name)
+		}
+		if c.Speed < 0.0 || c.Speed > 100.0 {
+			return deverr.Paramf("motor %q: speed out of range: 0.0-100.0", name)
+		}
+	}
+	for name, c := range cmds {
+		if err := b.Set(name, c.Direction, c.Speed); err != nil {
+			b.StopAll()
+			return fmt.Errorf("motor %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// StopAll stops every motor of every board, named or not. All the motors
+// are tried, the first error is returned.
+func (b *Bank) StopAll() error {
+	var first error
+	for _, a := range b.Addrs() {
+		for _, id := range []MotorId{M1, M2} {
+			if err := b.devs[a].MotorStop(id); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Close stops all the motors.
+func (b *Bank) Close() {
+	b.StopAll()
+}
@@ -1,15 +1,26 @@
 package drf0592
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"devices/deverr"
+
 	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/physic"
 )
 
 // I2CAddr is the default I2C address for the drf0592 components.
 const I2CAddr uint16 = 0x10
 
+// Addresses accepted by New.
+const (
+	MIN_ADDR = 0x01
+	MAX_ADDR = 0x70
+)
+
 // Register number
 type Register byte
 
@@ -53,6 +64,36 @@ const (
 	STA_ERR_PARAMETER           Status = 0x04
 )
 
+// Err returns the error matching the status, nil for STA_OK.
+func (s Status) Err() error {
+	switch s {
+	case STA_OK:
+		return nil
+	case STA_ERR_DEVICE_NOT_DETECTED:
+		return deverr.ErrNotDetected
+	case STA_ERR_SOFT_VERSION:
+		return deverr.ErrVersion
+	case STA_ERR_PARAMETER:
+		return deverr.ErrParameter
+	}
+	return deverr.ErrDevice
+}
+
+// StatusOf returns the status of the DFRobot library matching err.
+func StatusOf(err error) Status {
+	switch {
+	case err == nil:
+		return STA_OK
+	case errors.Is(err, deverr.ErrNotDetected):
+		return STA_ERR_DEVICE_NOT_DETECTED
+	case errors.Is(err, deverr.ErrVersion):
+		return STA_ERR_SOFT_VERSION
+	case errors.Is(err, deverr.ErrParameter):
+		return STA_ERR_PARAMETER
+	}
+	return STA_ERR
+}
+
 // Orientation
 type Direction byte
 
@@ -62,6 +103,24 @@ const (
 	STOP Direction = 0x05 // stop
 )
 
+// AngularVelocity is a signed rotation speed in revolutions per minute,
+// positive is clockwise.
+type AngularVelocity float64
+
+// RPM returns the velocity in revolutions per minute.
+func (a AngularVelocity) RPM() float64 {
+	return float64(a)
+}
+
+// RadPerSec returns the velocity in radians per second.
+func (a AngularVelocity) RadPerSec() float64 {
+	return float64(a) * 2 * math.Pi / 60
+}
+
+func (a AngularVelocity) String() string {
+	return fmt.Sprintf("%grpm", float64(a))
+}
+
 // Opts holds the configuration options.
 type Opts struct {
 	I2cAddress uint16
@@ -74,26 +133,38 @@ var DefaultOpts = Opts{
 
 // Dev is an handle to an DFR0592 Motors driver.
 type Dev struct {
-	c i2c.Dev
+	c      i2c.Dev
+	ratios [2]uint16          // encoder reduction ratios, 0 when not set
+	wheels [2]physic.Distance // wheel diameters, 0 when not set
 }
 
-func checkBoard(bus i2c.Bus, addr uint16) bool {
+// probeBoard checks the board identification like the DFRobot library: an
+// unknown PID is STA_ERR_DEVICE_NOT_DETECTED, an unknown VID STA_ERR_SOFT_VERSION.
+func probeBoard(bus i2c.Bus, addr uint16) error {
 	i2cbus := i2c.Dev{Bus: bus, Addr: addr}
-	r := make([]byte, 1)
-	err := i2cbus.Tx([]byte{_REG_PID}, r)
-	if err != nil {
-		return false
+	r := make([]byte, 2)
+	if err := i2cbus.Tx([]byte{_REG_PID}, r[:1]); err != nil {
+		return deverr.NotDetected(addr, deverr.Bus(addr, "read PID", err))
 	}
-	pid := r[0]
-	err = i2cbus.Tx([]byte{_REG_PVD}, r)
-	if err != nil {
-		return false
+	if err := i2cbus.Tx([]byte{_REG_PVD}, r[1:]); err != nil {
+		return deverr.NotDetected(addr, deverr.Bus(addr, "read VID", err))
 	}
-	vid := r[0]
-	if pid != _REG_DEF_PID || vid != _REG_DEF_VID {
-		return false
+	if r[0] != _REG_DEF_PID {
+		return deverr.NotDetected(addr, fmt.Errorf("PID 0x%02x", r[0]))
 	}
-	return true
+	if r[1] != _REG_DEF_VID {
+		return fmt.Errorf("%w 0x%02x at 0x%02x", deverr.ErrVersion, r[1], addr)
+	}
+	return nil
+}
+
+// Probe checks that a DFR0592 board answers at addr.
+func Probe(bus i2c.Bus, addr uint16) error {
+	return probeBoard(bus, addr)
+}
+
+func checkBoard(bus i2c.Bus, addr uint16) bool {
+	return probeBoard(bus, addr) == nil
 }
 
 func Detecte(bus i2c.Bus) []byte {
@@ -106,27 +177,32 @@ func Detecte(bus i2c.Bus) []byte {
 	return addrList
 }
 
-// New creates a new driver for CCS811 VOC sensor.
+// New creates a new driver for the DFR0592 motor driver HAT.
 func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
-	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x70 {
-		return nil, fmt.Errorf("invalid device address")
+	if opts.I2cAddress < MIN_ADDR || opts.I2cAddress > MAX_ADDR {
+		return nil, deverr.Paramf("invalid device address")
 	}
 
-	if !checkBoard(bus, opts.I2cAddress) {
-		return nil, fmt.Errorf("device not detected")
+	if err := probeBoard(bus, opts.I2cAddress); err != nil {
+		return nil, err
 	}
 
 	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}
 
-	// set DC motor mode
+	// set DC motor mode, the stepper mode of the firmware is not documented,
+	// Stepper drives steppers in DC mode
 	err := dev.c.Tx([]byte{_REG_CTRL_MODE, 0}, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error set DC motor mode")
+		return nil, deverr.Bus(dev.c.Addr, "set DC motor mode", err)
+	}
+	for _, id := range []MotorId{M1, M2} {
+		if err := dev.MotorStop(id); err != nil {
+			return nil, err
+		}
+		if err := dev.SetEncoderDisable(id); err != nil {
+			return nil, err
+		}
 	}
-	dev.MotorStop(M1)
-	dev.MotorStop(M2)
-	dev.SetEncoderDisable(M1)
-	dev.SetEncoderDisable(M2)
 	return dev, nil
 }
 
@@ -137,53 +213,126 @@ func (dev *Dev) Close() {
 	}
 }
 
+func checkId(id MotorId) error {
+	if id != M1 && id != M2 {
+		return deverr.Paramf("wrong motor id")
+	}
+	return nil
+}
+
 func (dev *Dev) SetEncoderEnable(id MotorId) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
 	err := dev.c.Tx([]byte{byte(_REG_ENCODER1_EN + 5*(id-1)), 0x01}, nil)
 	if err != nil {
-		return fmt.Errorf("error SetEncoderEnable: %v", err)
+		return deverr.Bus(dev.c.Addr, "SetEncoderEnable", err)
 	}
 	return nil
 }
 
 func (dev *Dev) SetEncoderDisable(id MotorId) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
 	err := dev.c.Tx([]byte{byte(_REG_ENCODER1_EN + 5*(id-1)), 0x0}, nil)
 	if err != nil {
-		return fmt.Errorf("error SetEncoderDisable: %v", err)
+		return deverr.Bus(dev.c.Addr, "SetEncoderDisable", err)
 	}
 	return nil
 }
 
 func (dev *Dev) SetEncoderReductionRatio(id MotorId, reductionRatio uint16) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
 	if reductionRatio < 1 || reductionRatio > 2000 {
-		return fmt.Errorf("reductionRatio out of range: 1-2000")
+		return deverr.Paramf("reductionRatio out of range: 1-2000")
 	}
 	err := dev.c.Tx([]byte{byte(_REG_ENCODER1_REDUCTION_RATIO + 5*(id-1)), byte(reductionRatio >> 8), byte(reductionRatio & 0xFF)}, nil)
 	if err != nil {
-		return fmt.Errorf("error SetEncoderReductionRatio: %v", err)
+		return deverr.Bus(dev.c.Addr, "SetEncoderReductionRatio", err)
 	}
+	dev.ratios[id-1] = reductionRatio
 	return nil
 }
 
-func (dev *Dev) GetEncoderSpeed(id MotorId) (int32, error) {
+// ReductionRatio returns the reduction ratio set on the encoder of motor id,
+// 0 when SetEncoderReductionRatio has not been called.
+func (dev *Dev) ReductionRatio(id MotorId) uint16 {
+	if checkId(id) != nil {
+		return 0
+	}
+	return dev.ratios[id-1]
+}
+
+// SetWheelDiameter sets the diameter of the wheel driven by motor id, used by
+// GetWheelSpeed.
+func (dev *Dev) SetWheelDiameter(id MotorId, diameter physic.Distance) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	if diameter <= 0 {
+		return deverr.Paramf("wheel diameter must be positive")
+	}
+	dev.wheels[id-1] = diameter
+	return nil
+}
+
+// GetEncoderSpeed returns the velocity of the output shaft of motor id. The
+// board divides the motor speed by the reduction ratio, so it must be set with
+// SetEncoderReductionRatio first.
+func (dev *Dev) GetEncoderSpeed(id MotorId) (AngularVelocity, error) {
+	if err := checkId(id); err != nil {
+		return 0, err
+	}
 	r := make([]byte, 2)
 	err := dev.c.Tx([]byte{byte(_REG_ENCODER1_SPPED + 5*(id-1))}, r)
 	if err != nil {
-		return 0, fmt.Errorf("error GetEncoderSpeed: %v", err)
+		return 0, deverr.Bus(dev.c.Addr, "GetEncoderSpeed", err)
+	}
+	// signed 16-bit big-endian RPM
+	return AngularVelocity(int16(uint16(r[0])<<8 | uint16(r[1]))), nil
+}
+
+// GetMotorSpeed returns the velocity of the motor shaft of motor id, before
+// the gearbox.
+func (dev *Dev) GetMotorSpeed(id MotorId) (AngularVelocity, error) {
+	v, err := dev.GetEncoderSpeed(id)
+	if err != nil {
+		return 0, err
+	}
+	if dev.ratios[id-1] == 0 {
+		return 0, deverr.Paramf("reduction ratio not set")
 	}
-	s := int32(r[0]*0xFF + r[1])
-	if s&0x8000 > 0 {
-		return int32(-(0x10000 - uint32(s))), nil
+	return v * AngularVelocity(dev.ratios[id-1]), nil
+}
+
+// GetWheelSpeed returns the signed linear speed of the wheel driven by motor
+// id, SetWheelDiameter must be called first.
+func (dev *Dev) GetWheelSpeed(id MotorId) (physic.Speed, error) {
+	if err := checkId(id); err != nil {
+		return 0, err
 	}
-	return s, nil
+	d := dev.wheels[id-1]
+	if d == 0 {
+		return 0, deverr.Paramf("wheel diameter not set")
+	}
+	v, err := dev.GetEncoderSpeed(id)
+	if err != nil {
+		return 0, err
+	}
+	// physic.Distance is in nm and physic.Speed in nm/s
+	return physic.Speed(math.Round(v.RPM() / 60 * math.Pi * float64(d))), nil
 }
 
 func (dev *Dev) SetMoterPwmFrequency(frequency int) error {
 	if frequency < 100 || frequency > 12750 {
-		return fmt.Errorf("frequency out of range: 100-12750")
+		return deverr.Paramf("frequency out of range: 100-12750")
 	}
 	err := dev.c.Tx([]byte{byte(_REG_MOTOR_PWM), byte(frequency / 50)}, nil)
 	if err != nil {
-		return fmt.Errorf("error SetMoterPwmFrequency: %v", err)
+		return deverr.Bus(dev.c.Addr, "SetMoterPwmFrequency", err)
 	}
 	time.Sleep(100 * time.Millisecond)
 	return nil
@@ -194,20 +343,23 @@ func (dev *Dev) SetMoterPwmFrequency(frequency int) error {
 // direction: Direction Motor orientation, CW (clockwise) or CCW (counterclockwise)
 // speed: float         Motor pwm duty cycle, in range 0 to 100, otherwise no effective
 func (dev *Dev) MotorMovement(id MotorId, direction Direction, speed float32) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
 	if direction != CW && direction != CCW {
-		return fmt.Errorf("wrond direction parameter")
+		return deverr.Paramf("wrong direction parameter")
 	}
 	if speed < 0.0 || speed > 100.0 {
-		return fmt.Errorf("speed out of range: 0.0-100.0")
+		return deverr.Paramf("speed out of range: 0.0-100.0")
 	}
 	reg := byte(_REG_MOTOR1_ORIENTATION + (id-1)*3)
 	err := dev.c.Tx([]byte{byte(reg), byte(direction)}, nil)
 	if err != nil {
-		return fmt.Errorf("error set orientation: %v", err)
+		return deverr.Bus(dev.c.Addr, "set orientation", err)
 	}
 	err = dev.c.Tx([]byte{byte(reg + 1), byte(speed), byte(uint16(speed*10.0) % 10)}, nil)
 	if err != nil {
-		return fmt.Errorf("error set speed: %v", err)
+		return deverr.Bus(dev.c.Addr, "set speed", err)
 	}
 	return nil
 }
@@ -215,22 +367,26 @@ func (dev *Dev) MotorMovement(id MotorId, direction Direction, speed float32) er
 // Motor stop
 // id: MotorId          Motor Id M1 or M2
 func (dev *Dev) MotorStop(id MotorId) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
 	err := dev.c.Tx([]byte{byte(_REG_MOTOR1_ORIENTATION + 3*(id-1)), byte(STOP)}, nil)
 	if err != nil {
-		return fmt.Errorf("error MotorStop: %v", err)
+		return deverr.Bus(dev.c.Addr, "MotorStop", err)
 	}
 	return nil
 }
 
 //  Set board controler address, reboot module to make it effective
+//  See ChangeAddress for a verified address change
 //  param address: byte    Address to set, range in 1 to 127
 func (dev *Dev) SetAddr(addr byte) error {
 	if addr < 1 || addr > 127 {
-		return fmt.Errorf("addres out of range (1..127)")
+		return deverr.Paramf("address out of range (1..127)")
 	}
 	err := dev.c.Tx([]byte{byte(_REG_SLAVE_ADDR), byte(addr)}, nil)
 	if err != nil {
-		return fmt.Errorf("error SetAddr: %v", err)
+		return deverr.Bus(dev.c.Addr, "SetAddr", err)
 	}
 	return nil
 }
@@ -1,25 +1,33 @@
 package drf0592
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"testing"
 	"time"
 
+	"devices/deverr"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+
 	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
 	host "periph.io/x/host/v3"
 )
 
 func TestDev_MotorMovement(t *testing.T) {
 	// Make sure periph is initialized.
 	if _, err := host.Init(); err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 
 	// Use i2creg I²C bus registry to find the first available I²C bus.
 	b, err := i2creg.Open("")
 	if err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 	defer b.Close()
 
@@ -43,11 +51,460 @@ func TestDev_MotorMovement(t *testing.T) {
 		m.MotorMovement(M2, CCW, i)
 		time.Sleep(2 * time.Second)
 		s, _ := m.GetEncoderSpeed(M1)
-		fmt.Printf("M1 speed: %.2f, encoder speed:%d\n", i, s)
+		fmt.Printf("M1 speed: %.2f, encoder speed:%s\n", i, s)
 		s, _ = m.GetEncoderSpeed(M2)
-		fmt.Printf("M2 speed: %.2f, encoder speed:%d\n", i, s)
+		fmt.Printf("M2 speed: %.2f, encoder speed:%s\n", i, s)
 	}
 	m.MotorStop(M1)
 	m.MotorStop(M2)
 	m.Close()
 }
+
+func newEmu() (*i2cemu.Bus, *i2cemu.RegisterFile) {
+	b := i2cemu.NewBus()
+	rf := i2cemu.NewRegisterFile()
+	rf.Set(_REG_PID, _REG_DEF_PID, _REG_DEF_VID)
+	rf.ReadOnly(_REG_PID, _REG_PVD)
+	b.Attach(I2CAddr, rf)
+	return b, rf
+}
+
+func TestDev_emu(t *testing.T) {
+	b, rf := newEmu()
+	if dl := Detecte(b); len(dl) != 1 || dl[0] != byte(I2CAddr) {
+		t.Errorf("Detecte() = %v, want [0x%02x]", dl, I2CAddr)
+	}
+	rf.Set(_REG_CTRL_MODE, 1)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := rf.Regs[_REG_CTRL_MODE]; v != 0 {
+		t.Errorf("control mode = %d, want DC mode", v)
+	}
+	if err := m.MotorMovement(M2, CCW, 42.5); err != nil {
+		t.Fatal(err)
+	}
+	if got := rf.Get(_REG_MOTOR2_ORIENTATION, 3); got[0] != byte(CCW) || got[1] != 42 || got[2] != 5 {
+		t.Errorf("motor 2 registers = %v", got)
+	}
+	m.Close()
+	if rf.Regs[_REG_MOTOR1_ORIENTATION] != byte(STOP) || rf.Regs[_REG_MOTOR2_ORIENTATION] != byte(STOP) {
+		t.Errorf("motors not stopped by Close")
+	}
+
+	// wrong product id
+	rf.Set(_REG_PID, 0x00)
+	if _, err := New(b, &DefaultOpts); err == nil {
+		t.Errorf("New succeeded on unknown board")
+	}
+}
+
+func TestDev_sim(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewDFR0592()
+	b.Attach(I2CAddr, s)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetEncoderEnable(M1)
+	m.SetEncoderReductionRatio(M1, 50)
+	m.MotorMovement(M1, CW, 50)
+	if v, err := m.GetEncoderSpeed(M1); err != nil || v != 70 {
+		t.Errorf("GetEncoderSpeed(M1) = %s, %v, want 70rpm", v, err)
+	}
+	if v, err := m.GetEncoderSpeed(M2); err != nil || v != 0 {
+		t.Errorf("GetEncoderSpeed(M2) = %s, %v, want 0rpm", v, err)
+	}
+}
+
+func TestDev_units(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewDFR0592()
+	b.Attach(I2CAddr, s)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetEncoderEnable(M1)
+	if _, err := m.GetMotorSpeed(M1); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("GetMotorSpeed() without ratio = %v", err)
+	}
+	if _, err := m.GetWheelSpeed(M1); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("GetWheelSpeed() without diameter = %v", err)
+	}
+	if err := m.SetEncoderReductionRatio(M1, 50); err != nil || m.ReductionRatio(M1) != 50 || m.ReductionRatio(M2) != 0 {
+		t.Errorf("ReductionRatio() = %d, %d, %v", m.ReductionRatio(M1), m.ReductionRatio(M2), err)
+	}
+	if err := m.SetWheelDiameter(M1, 60*physic.MilliMetre); err != nil {
+		t.Fatal(err)
+	}
+	// 7000rpm motor at 50% backwards, negative values use the high bit
+	m.MotorMovement(M1, CCW, 50)
+	v, err := m.GetEncoderSpeed(M1)
+	if err != nil || v != -70 {
+		t.Fatalf("GetEncoderSpeed() = %s, %v, want -70rpm", v, err)
+	}
+	if r := v.RadPerSec(); math.Abs(r+7*math.Pi/3) > 1e-9 {
+		t.Errorf("RadPerSec() = %g", r)
+	}
+	if v, err := m.GetMotorSpeed(M1); err != nil || v != -3500 {
+		t.Errorf("GetMotorSpeed() = %s, %v, want -3500rpm", v, err)
+	}
+	// 70rpm * pi * 60mm / 60s = 70pi mm/s
+	if v, err := m.GetWheelSpeed(M1); err != nil || v != -219911*physic.MicroMetrePerSecond-486*physic.NanoMetrePerSecond {
+		t.Errorf("GetWheelSpeed() = %s, %v", v, err)
+	}
+}
+
+func TestSpeedController(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewDFR0592()
+	now := time.Unix(0, 0)
+	s.Now = func() time.Time { return now }
+	s.TimeConstant = 200 * time.Millisecond
+	// encoder 1 reads fail while failRead is set
+	failRead := false
+	b.Attach(I2CAddr, i2cemu.DeviceFunc(func(w, r []byte) error {
+		if failRead && len(r) > 0 && w[0] == _REG_ENCODER1_SPPED {
+			return errors.New("bus fault")
+		}
+		return s.Tx(w, r)
+	}))
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetEncoderReductionRatio(M1, 50)
+	m.SetEncoderReductionRatio(M2, 50)
+
+	// steps are run by the test, the loop period never elapses
+	opts := DefaultSpeedControlOpts
+	opts.Period = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := NewSpeedController(ctx, m, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(n int) {
+		for i := 0; i < n; i++ {
+			now = now.Add(50 * time.Millisecond)
+			c.step(50 * time.Millisecond)
+		}
+	}
+
+	c.SetTarget(M1, 60)
+	c.SetTarget(M2, -40)
+	run(100)
+	if st := c.State(M1); st.Err != nil || st.Speed < 59 || st.Speed > 61 {
+		t.Errorf("M1 state = %+v, want 60 RPM", st)
+	}
+	if st := c.State(M2); st.Err != nil || st.Speed < -41 || st.Speed > -39 {
+		t.Errorf("M2 state = %+v, want -40 RPM", st)
+	}
+
+	// out of reach target saturates without winding up
+	c.SetTarget(M1, 1000)
+	run(100)
+	if st := c.State(M1); st.Output != 100 || st.Integral > 100 {
+		t.Errorf("saturated M1 state = %+v", st)
+	}
+	c.SetTarget(M1, 60)
+	run(20)
+	if st := c.State(M1); st.Speed > 70 {
+		t.Errorf("M1 state = %+v, integral wound up", st)
+	}
+
+	c.SetTarget(M2, 0)
+	run(1)
+	if st := c.State(M2); st.Output != 0 || st.Integral != 0 {
+		t.Errorf("M2 state = %+v after zero target", st)
+	}
+
+	// a failed encoder read stops the motor instead of keeping its output
+	failRead = true
+	run(1)
+	if st := c.State(M1); st.Err == nil || st.Output != 0 || st.Integral != 0 {
+		t.Errorf("M1 state = %+v after a read error", st)
+	}
+	if v := s.Get(_REG_MOTOR1_ORIENTATION, 1); v[0] != byte(STOP) {
+		t.Errorf("M1 not stopped after a read error")
+	}
+	failRead = false
+	run(20)
+	if st := c.State(M1); st.Err != nil || st.Speed < 50 {
+		t.Errorf("M1 state = %+v after the bus recovered", st)
+	}
+
+	// the end of ctx stops both motors
+	c.SetTarget(M2, -40)
+	run(20)
+	cancel()
+	<-c.done
+	for _, reg := range []byte{_REG_MOTOR1_ORIENTATION, _REG_MOTOR2_ORIENTATION} {
+		if v := s.Get(reg, 1); v[0] != byte(STOP) {
+			t.Errorf("motor at 0x%02x not stopped when ctx is done", reg)
+		}
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStepper(t *testing.T) {
+	b, rf := newEmu()
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coils := func() [2]int {
+		var c [2]int
+		for i, reg := range []byte{_REG_MOTOR1_ORIENTATION, _REG_MOTOR2_ORIENTATION} {
+			r := rf.Get(reg, 2)
+			switch Direction(r[0]) {
+			case CW:
+				c[i] = int(r[1])
+			case CCW:
+				c[i] = -int(r[1])
+			}
+		}
+		return c
+	}
+
+	s, err := NewStepper(m, HALF_STEP, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{100, 0}, {100, 100}, {0, 100}, {-100, 100}, {-100, 0}, {-100, -100}, {0, -100}, {100, -100}, {100, 0}}
+	if c := coils(); c != want[0] {
+		t.Errorf("coils at start = %v, want %v", c, want[0])
+	}
+	for i := 1; i < len(want); i++ {
+		if err := s.Step(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		if c := coils(); c != want[i] {
+			t.Errorf("coils at half step %d = %v, want %v", i, c, want[i])
+		}
+	}
+	s.Step(context.Background(), -3)
+	if p := s.Position(); p != 5 {
+		t.Errorf("Position() = %d, want 5", p)
+	}
+	if c := coils(); c != want[5] {
+		t.Errorf("coils after stepping back = %v, want %v", c, want[5])
+	}
+	s.Release()
+	if c := coils(); c != [2]int{} {
+		t.Errorf("coils after Release = %v", c)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Step(ctx, 100); err != context.Canceled {
+		t.Errorf("Step() = %v, want %v", err, context.Canceled)
+	}
+	if err := s.Step(context.Background(), math.MinInt64); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("Step(MinInt64) = %v", err)
+	}
+
+	if _, err := NewStepper(m, 3, 100); err == nil {
+		t.Errorf("NewStepper accepted 3 microsteps")
+	}
+	for _, v := range []float64{0, -1, math.NaN(), math.Inf(1), 2e9} {
+		if err := s.SetSpeed(float32(v)); !errors.Is(err, deverr.ErrParameter) {
+			t.Errorf("SetSpeed(%g) = %v", v, err)
+		}
+	}
+	// a Stepper without speed steps at the default interval
+	s.interval = 0
+	if err := s.Step(context.Background(), 1); err != nil {
+		t.Errorf("Step() without speed = %v", err)
+	}
+	// cos and sin of 22.5°
+	if a, b := coilDuties(MICROSTEP_4, 1); a != 92.4 || b != 38.3 {
+		t.Errorf("coilDuties(MICROSTEP_4, 1) = %f, %f", a, b)
+	}
+	if a, b := coilDuties(FULL_STEP, -1); a != 100 || b != -100 {
+		t.Errorf("coilDuties(FULL_STEP, -1) = %f, %f", a, b)
+	}
+}
+
+func TestBank(t *testing.T) {
+	b := i2cemu.NewBus()
+	s1, s2 := sim.NewDFR0592(), sim.NewDFR0592()
+	b.Attach(0x10, s1)
+	b.Attach(0x11, s2)
+	// found by Detecte but refused by New, left out of the bank
+	b.Attach(0x72, sim.NewDFR0592())
+
+	bank, err := NewBank(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := bank.Addrs(); len(a) != 2 || a[0] != 0x10 || a[1] != 0x11 {
+		t.Fatalf("Addrs() = %v", a)
+	}
+	for _, m := range []struct {
+		name string
+		addr uint16
+		id   MotorId
+	}{
+		{"front-left", 0x10, M1},
+		{"front-right", 0x10, M2},
+		{"rear-left", 0x11, M1},
+		{"rear-right", 0x11, M2},
+	} {
+		if err := bank.Assign(m.name, m.addr, m.id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bank.Assign("spare", 0x10, M1); err == nil {
+		t.Errorf("motor assigned twice")
+	}
+	if err := bank.Assign("spare", 0x12, M1); err == nil {
+		t.Errorf("motor assigned on a missing board")
+	}
+
+	if err := bank.SetAll(map[string]MotorCommand{
+		"front-left": {CW, 50},
+		"rear-right": {CCW, 25},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if v := s1.Get(_REG_MOTOR1_ORIENTATION, 2); v[0] != byte(CW) || v[1] != 50 {
+		t.Errorf("front-left registers = %v", v)
+	}
+	if v := s2.Get(_REG_MOTOR2_ORIENTATION, 2); v[0] != byte(CCW) || v[1] != 25 {
+		t.Errorf("rear-right registers = %v", v)
+	}
+
+	// invalid commands move nothing
+	if err := bank.SetAll(map[string]MotorCommand{"rear-left": {CW, 10}, "middle": {CW, 10}}); err == nil {
+		t.Errorf("SetAll accepted an unknown motor")
+	}
+	if v := s2.Get(_REG_MOTOR1_ORIENTATION, 1); v[0] != byte(STOP) {
+		t.Errorf("rear-left moved by an invalid SetAll")
+	}
+
+	// a failing board stops everything
+	s2.SetError(errors.New("bus error"))
+	if err := bank.SetAll(map[string]MotorCommand{"rear-left": {CW, 10}}); err == nil {
+		t.Errorf("SetAll succeeded on a failing board")
+	}
+	if v := s1.Get(_REG_MOTOR1_ORIENTATION, 1); v[0] != byte(STOP) {
+		t.Errorf("front-left not stopped after a failure")
+	}
+	if err := bank.StopAll(); err == nil {
+		t.Errorf("StopAll succeeded on a failing board")
+	}
+}
+
+func TestChangeAddress(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewDFR0592()
+	s.Attach(b, I2CAddr)
+	b.Attach(0x20, i2cemu.NewRegisterFile())
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(d time.Duration) { ProbeTimeout = d }(ProbeTimeout)
+	ProbeTimeout = 200 * time.Millisecond
+
+	if _, err := m.ChangeAddress(0x20, s.PowerCycle); err == nil {
+		t.Errorf("ChangeAddress to a used address succeeded")
+	}
+	if _, err := m.ChangeAddress(0x7F, s.PowerCycle); err == nil {
+		t.Errorf("ChangeAddress to 0x7F succeeded")
+	}
+
+	// the board was not power cycled
+	if _, err := m.ChangeAddress(0x12, func() error { return nil }); err == nil {
+		t.Errorf("ChangeAddress without power cycle succeeded")
+	}
+
+	m2, err := m.ChangeAddress(0x12, s.PowerCycle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl := Detecte(b); len(dl) != 1 || dl[0] != 0x12 {
+		t.Errorf("Detecte() = %v, want [0x12]", dl)
+	}
+	if err := m2.MotorMovement(M1, CW, 10); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChangeAddress_outOfRange(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewDFR0592()
+	s.Attach(b, 0x7A)
+	defer func(d time.Duration) { ProbeTimeout = d }(ProbeTimeout)
+	ProbeTimeout = 200 * time.Millisecond
+
+	if dl := Detecte(b); len(dl) != 1 || dl[0] != 0x7A {
+		t.Fatalf("Detecte() = %v, want [0x7A]", dl)
+	}
+	if _, err := ChangeAddress(b, 0x7A, 0x7B, s.PowerCycle); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("ChangeAddress() to 0x7B = %v", err)
+	}
+	if _, err := ChangeAddress(b, 0x11, 0x12, s.PowerCycle); !errors.Is(err, deverr.ErrNotDetected) {
+		t.Errorf("ChangeAddress() of a missing board = %v", err)
+	}
+	m, err := ChangeAddress(b, 0x7A, 0x12, s.PowerCycle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl := Detecte(b); len(dl) != 1 || dl[0] != 0x12 {
+		t.Errorf("Detecte() = %v, want [0x12]", dl)
+	}
+	if err := m.MotorMovement(M1, CW, 10); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	b, rf := newEmu()
+	if _, err := New(b, &Opts{I2cAddress: 0x11}); !errors.Is(err, deverr.ErrNotDetected) || !errors.Is(err, deverr.ErrBus) || StatusOf(err) != STA_ERR_DEVICE_NOT_DETECTED {
+		t.Errorf("New() at a free address = %v", err)
+	}
+	if _, err := New(b, &Opts{I2cAddress: 0x7F}); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("New() at 0x7F = %v", err)
+	}
+	rf.Set(_REG_PVD, 0x20)
+	if _, err := New(b, &DefaultOpts); !errors.Is(err, deverr.ErrVersion) || StatusOf(err) != STA_ERR_SOFT_VERSION {
+		t.Errorf("New() with another VID = %v", err)
+	}
+	rf.Set(_REG_PVD, _REG_DEF_VID)
+
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MotorMovement(M1, CW, 120); !errors.Is(err, deverr.ErrParameter) || StatusOf(err) != STA_ERR_PARAMETER {
+		t.Errorf("MotorMovement(120) = %v", err)
+	}
+	if err := m.MotorStop(3); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("MotorStop(3) = %v", err)
+	}
+	cause := errors.New("remote I/O error")
+	rf.SetError(cause)
+	err = m.MotorStop(M1)
+	var be *deverr.BusError
+	if !errors.Is(err, deverr.ErrBus) || !errors.Is(err, cause) || !errors.As(err, &be) || be.Addr != I2CAddr {
+		t.Errorf("MotorStop() on a failing bus = %v", err)
+	}
+	if StatusOf(err) != STA_ERR || StatusOf(nil) != STA_OK {
+		t.Errorf("StatusOf() = %d", StatusOf(err))
+	}
+	if !errors.Is(STA_ERR_PARAMETER.Err(), deverr.ErrParameter) || STA_OK.Err() != nil {
+		t.Errorf("Status.Err() mismatch")
+	}
+	// New stops the motors and reports failures
+	if _, err := New(b, &DefaultOpts); err == nil {
+		t.Errorf("New() succeeded on a failing bus")
+	}
+}
@@ -0,0 +1,190 @@
+package drf0592
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"devices/deverr"
+)
+
+// SpeedControlOpts holds the speed controller options.
+// Gains are in duty cycle percent, the error is in RPM of the output shaft.
+type SpeedControlOpts struct {
+	Period time.Duration // control loop period
+	Kp     float32       // % per RPM
+	Ki     float32       // % per RPM.s
+	Kd     float32       // % per RPM/s, applied to the measured speed
+	Kff    float32       // feed-forward, % per target RPM
+}
+
+// DefaultSpeedControlOpts are conservative gains, to be tuned for each motor.
+var DefaultSpeedControlOpts = SpeedControlOpts{
+	Period: 50 * time.Millisecond,
+	Kp:     0.2,
+	Ki:     2,
+	Kd:     0,
+	Kff:    0,
+}
+
+// SpeedState is the state of the speed loop of a motor, for tuning.
+type SpeedState struct {
+	Target   float32 // RPM
+	Speed    float32 // measured RPM
+	Error    float32 // Target - Speed
+	Integral float32 // integral term, in %
+	Output   float32 // signed duty cycle in %, positive is CW
+	Err      error   // last bus error, the motor is stopped on a read error
+}
+
+type speedLoop struct {
+	SpeedState
+	prevSpeed float32
+	started   bool
+}
+
+// SpeedController runs a PID loop per motor against the encoder speed.
+// Encoders must be wired and their reduction ratio set.
+type SpeedController struct {
+	dev  *Dev
+	opts SpeedControlOpts
+
+	mu      sync.Mutex
+	loops   [2]speedLoop
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopErr error
+}
+
+// NewSpeedController enables both encoders and starts the control loop until
+// ctx is done or Stop is called. Motors are stopped until a target is set,
+// and again when the loop ends.
+func NewSpeedController(ctx context.Context, dev *Dev, opts *SpeedControlOpts) (*SpeedController, error) {
+	if opts.Period <= 0 {
+		return nil, deverr.Paramf("invalid control period %s", opts.Period)
+	}
+	for _, id := range []MotorId{M1, M2} {
+		if err := dev.SetEncoderEnable(id); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := &SpeedController{dev: dev, opts: *opts, cancel: cancel, done: make(chan struct{})}
+	go c.run(ctx)
+	return c, nil
+}
+
+// SetTarget sets the target speed in RPM of the output shaft, positive is CW.
+// A zero target stops the motor and resets its loop.
+func (c *SpeedController) SetTarget(id MotorId, rpm float32) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loops[id-1].Target = rpm
+	return nil
+}
+
+// State returns the loop state of a motor.
+func (c *SpeedController) State(id MotorId) SpeedState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := checkId(id); err != nil {
+		return SpeedState{Err: err}
+	}
+	return c.loops[id-1].SpeedState
+}
+
+// Stop ends the control loop and stops both motors.
+func (c *SpeedController) Stop() error {
+	c.cancel()
+	<-c.done
+	return c.stopErr
+}
+
+func (c *SpeedController) run(ctx context.Context) {
+	defer close(c.done)
+	defer c.stopMotors()
+	ticker := time.NewTicker(c.opts.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.step(c.opts.Period)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stopMotors stops both motors when the loop ends.
+func (c *SpeedController) stopMotors() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err1 := c.dev.MotorStop(M1)
+	err2 := c.dev.MotorStop(M2)
+	c.stopErr = err1
+	if err1 == nil {
+		c.stopErr = err2
+	}
+}
+
+// step runs one iteration of both loops, dt after the previous one.
+func (c *SpeedController) step(dt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.loops {
+		c.update(MotorId(i+1), &c.loops[i], float32(dt.Seconds()))
+	}
+}
+
+func (c *SpeedController) update(id MotorId, l *speedLoop, dt float32) {
+	s, err := c.dev.GetEncoderSpeed(id)
+	if err != nil {
+		// do not run open loop on the last output
+		l.Integral, l.Output, l.started = 0, 0, false
+		c.dev.MotorStop(id)
+		l.Err = err
+		return
+	}
+	l.Speed = float32(s.RPM())
+	l.Error = l.Target - l.Speed
+	if l.Target == 0 {
+		l.Integral, l.Output, l.started = 0, 0, false
+		l.Err = c.dev.MotorStop(id)
+		return
+	}
+
+	var derivative float32
+	if l.started {
+		derivative = -(l.Speed - l.prevSpeed) / dt
+	}
+	l.prevSpeed = l.Speed
+	l.started = true
+
+	base := c.opts.Kff*l.Target + c.opts.Kp*l.Error + c.opts.Kd*derivative
+	integral := l.Integral + c.opts.Ki*l.Error*dt
+	out := base + integral
+	// anti-windup: stop integrating when the output saturates
+	if out > 100 {
+		out = 100
+		if l.Error < 0 {
+			l.Integral = integral
+		}
+	} else if out < -100 {
+		out = -100
+		if l.Error > 0 {
+			l.Integral = integral
+		}
+	} else {
+		l.Integral = integral
+	}
+	l.Output = out
+
+	dir, duty := CW, out
+	if out < 0 {
+		dir, duty = CCW, -out
+	}
+	l.Err = c.dev.MotorMovement(id, dir, duty)
+}
@@ -0,0 +1,179 @@
+package drf0592
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"devices/deverr"
+)
+
+// StepMode is the number of steps per full step of the motor.
+type StepMode int
+
+const (
+	FULL_STEP    StepMode = 1 // two coils on, full torque
+	HALF_STEP    StepMode = 2
+	MICROSTEP_4  StepMode = 4
+	MICROSTEP_8  StepMode = 8
+	MICROSTEP_16 StepMode = 16
+)
+
+// DEFAULT_STEP_INTERVAL is the step interval of a Stepper whose speed was not set.
+const DEFAULT_STEP_INTERVAL = 10 * time.Millisecond
+
+// Stepper drives a bipolar stepper motor with one coil on each motor output,
+// coil A on M1 and coil B on M2.
+//
+// The board firmware has a stepper control mode but its registers are not
+// documented, so steps are generated by the host with the board in DC mode:
+// each step updates the direction and duty cycle of both H-bridges. The step
+// rate is limited by the I²C bus, each step takes up to four transactions.
+// Microsteps set the coil duty cycles to the sine and cosine of the electrical
+// angle, their accuracy depends on the motor and the PWM frequency, a high
+// PWM frequency gives smoother microsteps.
+type Stepper struct {
+	dev      *Dev
+	mode     StepMode
+	interval time.Duration
+	position int64
+	coils    [2]float32 // last signed duty cycle of each coil, in %
+}
+
+// NewStepper energizes the coils at the current position.
+// stepsPerSecond is in steps of mode, it can be changed with SetSpeed.
+func NewStepper(dev *Dev, mode StepMode, stepsPerSecond float32) (*Stepper, error) {
+	switch mode {
+	case FULL_STEP, HALF_STEP, MICROSTEP_4, MICROSTEP_8, MICROSTEP_16:
+	default:
+		return nil, deverr.Paramf("invalid step mode %d", mode)
+	}
+	s := &Stepper{dev: dev, mode: mode, coils: [2]float32{math.MaxFloat32, math.MaxFloat32}}
+	if err := s.SetSpeed(stepsPerSecond); err != nil {
+		return nil, err
+	}
+	if err := s.energize(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetSpeed sets the step rate in steps per second, up to one step per
+// nanosecond. In practice the bus limits the rate to a few hundred steps per
+// second.
+func (s *Stepper) SetSpeed(stepsPerSecond float32) error {
+	v := float64(stepsPerSecond)
+	if math.IsNaN(v) || math.IsInf(v, 0) || v <= 0 {
+		return deverr.Paramf("speed must be positive and finite")
+	}
+	interval := time.Duration(float64(time.Second) / v)
+	if interval <= 0 {
+		return deverr.Paramf("speed %g steps/s too high", v)
+	}
+	s.interval = interval
+	return nil
+}
+
+// Position returns the position in steps from the start.
+func (s *Stepper) Position() int64 {
+	return s.position
+}
+
+// Step moves the motor by steps, positive steps turn forward, from
+// -math.MaxInt64 to math.MaxInt64.
+// It returns when the move is done or ctx is done.
+func (s *Stepper) Step(ctx context.Context, steps int64) error {
+	if steps == math.MinInt64 {
+		return deverr.Paramf("%d steps out of range", steps)
+	}
+	dir := int64(1)
+	if steps < 0 {
+		dir, steps = -1, -steps
+	}
+	interval := s.interval
+	if interval <= 0 {
+		interval = DEFAULT_STEP_INTERVAL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := int64(0); i < steps; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		s.position += dir
+		if err := s.energize(); err != nil {
+			s.position -= dir
+			return err
+		}
+	}
+	return nil
+}
+
+// Release turns the coils off, the motor does not hold its position anymore.
+// The next step energizes the coils again.
+func (s *Stepper) Release() error {
+	s.coils = [2]float32{math.MaxFloat32, math.MaxFloat32}
+	if err := s.dev.MotorStop(M1); err != nil {
+		return err
+	}
+	return s.dev.MotorStop(M2)
+}
+
+// coilDuties returns the signed duty cycles of coils A and B at a position.
+func coilDuties(mode StepMode, position int64) (float32, float32) {
+	// 4 full steps per electrical revolution
+	n := int64(4 * mode)
+	p := position % n
+	if p < 0 {
+		p += n
+	}
+	angle := 2 * math.Pi * float64(p) / float64(n)
+	if mode == FULL_STEP {
+		angle += math.Pi / 4
+	}
+	a, b := math.Cos(angle), math.Sin(angle)
+	if mode <= HALF_STEP {
+		// full current in each energized coil
+		a, b = sign(a), sign(b)
+	}
+	return float32(math.Round(a*1000) / 10), float32(math.Round(b*1000) / 10)
+}
+
+func sign(v float64) float64 {
+	switch {
+	case v > 1e-9:
+		return 1
+	case v < -1e-9:
+		return -1
+	}
+	return 0
+}
+
+func (s *Stepper) energize() error {
+	a, b := coilDuties(s.mode, s.position)
+	for i, duty := range [2]float32{a, b} {
+		if duty == s.coils[i] {
+			continue
+		}
+		id := MotorId(i + 1)
+		var err error
+		switch {
+		case duty > 0:
+			err = s.dev.MotorMovement(id, CW, duty)
+		case duty < 0:
+			err = s.dev.MotorMovement(id, CCW, -duty)
+		default:
+			err = s.dev.MotorStop(id)
+		}
+		if err != nil {
+			return err
+		}
+		s.coils[i] = duty
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package i2cemu emulates an I²C bus and register based devices in pure Go,
+// so that drivers can be tested without hardware.
+//
+// A Bus implements i2c.Bus and dispatches transactions to the Device attached
+// at the addressed slave address. RegisterFile is a scriptable Device with a
+// register pointer, auto-increment, read-only registers and side-effect hooks.
+package i2cemu
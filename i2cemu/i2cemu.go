@@ -0,0 +1,242 @@
+package i2cemu
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// ErrNoDevice is returned when no device acknowledges the address.
+var ErrNoDevice = errors.New("i2cemu: no device at address")
+
+// Device is a peripheral attached to an emulated bus.
+type Device interface {
+	// Tx handles a transaction, write is done first, then read.
+	Tx(w, r []byte) error
+}
+
+// DeviceFunc adapts a function to the Device interface, for devices that are
+// not register based like command/response sensors.
+type DeviceFunc func(w, r []byte) error
+
+// Tx implements Device.
+func (f DeviceFunc) Tx(w, r []byte) error {
+	return f(w, r)
+}
+
+// Bus is an emulated I²C bus, it implements i2c.BusCloser.
+type Bus struct {
+	mu      sync.Mutex
+	devices map[uint16]Device
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{devices: map[uint16]Device{}}
+}
+
+// Attach connects d at addr.
+func (b *Bus) Attach(addr uint16, d Device) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.devices[addr]; ok {
+		return fmt.Errorf("i2cemu: address 0x%02x already in use", addr)
+	}
+	b.devices[addr] = d
+	return nil
+}
+
+// Detach disconnects the device at addr.
+func (b *Bus) Detach(addr uint16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.devices, addr)
+}
+
+// Move changes the address of an attached device, as devices do when their
+// address register is written.
+func (b *Bus) Move(from, to uint16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d, ok := b.devices[from]
+	if !ok {
+		return fmt.Errorf("%w 0x%02x", ErrNoDevice, from)
+	}
+	if _, ok := b.devices[to]; ok && from != to {
+		return fmt.Errorf("i2cemu: address 0x%02x already in use", to)
+	}
+	delete(b.devices, from)
+	b.devices[to] = d
+	return nil
+}
+
+// Device returns the device attached at addr.
+func (b *Bus) Device(addr uint16) Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.devices[addr]
+}
+
+func (b *Bus) String() string {
+	return "i2cemu"
+}
+
+// Tx implements i2c.Bus.
+func (b *Bus) Tx(addr uint16, w, r []byte) error {
+	b.mu.Lock()
+	d, ok := b.devices[addr]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w 0x%02x", ErrNoDevice, addr)
+	}
+	return d.Tx(w, r)
+}
+
+// SetSpeed implements i2c.Bus.
+func (b *Bus) SetSpeed(f physic.Frequency) error {
+	return nil
+}
+
+// Close implements i2c.BusCloser.
+func (b *Bus) Close() error {
+	return nil
+}
+
+// WriteHook is called after a byte has been written to a register.
+type WriteHook func(rf *RegisterFile, reg byte, value byte)
+
+// ReadHook returns the value of a register being read.
+type ReadHook func(rf *RegisterFile, reg byte) byte
+
+// RegisterFile is a device made of 256 byte registers.
+//
+// The first byte written selects the register, next bytes are written from
+// there, reads continue from the register pointer. Hooks are called with the
+// register file locked, they must access Regs directly.
+type RegisterFile struct {
+	mu sync.Mutex
+	// Regs holds the register values.
+	Regs [256]byte
+	// AutoIncrement advances the register pointer after each byte.
+	AutoIncrement bool
+	// PointerMask is applied to the register byte, e.g. to drop a command bit.
+	PointerMask byte
+	// Next overrides the pointer increment, for registers like FIFOs that do not advance.
+	Next func(ptr byte) byte
+
+	ptr      byte
+	readOnly [256]bool
+	onWrite  map[byte]WriteHook
+	onRead   map[byte]ReadHook
+	err      error
+}
+
+// NewRegisterFile returns a register file with auto-increment enabled.
+func NewRegisterFile() *RegisterFile {
+	return &RegisterFile{
+		AutoIncrement: true,
+		PointerMask:   0xFF,
+		onWrite:       map[byte]WriteHook{},
+		onRead:        map[byte]ReadHook{},
+	}
+}
+
+// Set writes values from reg, ignoring read-only flags and hooks.
+func (rf *RegisterFile) Set(reg byte, values ...byte) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	for i, v := range values {
+		rf.Regs[reg+byte(i)] = v
+	}
+}
+
+// Get reads n registers from reg, bypassing hooks.
+func (rf *RegisterFile) Get(reg byte, n int) []byte {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = rf.Regs[reg+byte(i)]
+	}
+	return out
+}
+
+// ReadOnly makes writes to regs ignored. Write hooks are still called.
+func (rf *RegisterFile) ReadOnly(regs ...byte) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	for _, r := range regs {
+		rf.readOnly[r] = true
+	}
+}
+
+// OnWrite registers a hook called after reg is written.
+func (rf *RegisterFile) OnWrite(reg byte, hook WriteHook) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.onWrite[reg] = hook
+}
+
+// OnRead registers a hook providing the value of reg.
+func (rf *RegisterFile) OnRead(reg byte, hook ReadHook) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.onRead[reg] = hook
+}
+
+// SetError makes every transaction fail with err, nil restores normal operation.
+func (rf *RegisterFile) SetError(err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.err = err
+}
+
+// Do calls f with the register file locked, so that simulators can read
+// registers and update the state used by their hooks atomically.
+func (rf *RegisterFile) Do(f func(rf *RegisterFile)) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	f(rf)
+}
+
+func (rf *RegisterFile) advance() {
+	if rf.Next != nil {
+		rf.ptr = rf.Next(rf.ptr)
+	} else if rf.AutoIncrement {
+		rf.ptr++
+	}
+}
+
+// Tx implements Device.
+func (rf *RegisterFile) Tx(w, r []byte) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.err != nil {
+		return rf.err
+	}
+	if len(w) > 0 {
+		rf.ptr = w[0] & rf.PointerMask
+		for _, v := range w[1:] {
+			reg := rf.ptr
+			if !rf.readOnly[reg] {
+				rf.Regs[reg] = v
+			}
+			if hook, ok := rf.onWrite[reg]; ok {
+				hook(rf, reg, v)
+			}
+			rf.advance()
+		}
+	}
+	for i := range r {
+		reg := rf.ptr
+		if hook, ok := rf.onRead[reg]; ok {
+			r[i] = hook(rf, reg)
+		} else {
+			r[i] = rf.Regs[reg]
+		}
+		rf.advance()
+	}
+	return nil
+}
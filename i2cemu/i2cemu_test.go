@@ -0,0 +1,131 @@
+package i2cemu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+var _ i2c.BusCloser = &Bus{}
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	rf := NewRegisterFile()
+	if err := b.Attach(0x10, rf); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Attach(0x10, rf); err == nil {
+		t.Errorf("Attach twice succeeded")
+	}
+	if err := b.Tx(0x11, []byte{0}, nil); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Tx(0x11) = %v, want %v", err, ErrNoDevice)
+	}
+	if err := b.Move(0x10, 0x12); err != nil {
+		t.Fatal(err)
+	}
+	if b.Device(0x12) != rf || b.Device(0x10) != nil {
+		t.Errorf("Move did not change the device address")
+	}
+	b.Detach(0x12)
+	if err := b.Tx(0x12, []byte{0}, nil); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Tx after Detach = %v, want %v", err, ErrNoDevice)
+	}
+}
+
+func TestRegisterFile(t *testing.T) {
+	b := NewBus()
+	rf := NewRegisterFile()
+	b.Attach(0x20, rf)
+	d := i2c.Dev{Bus: b, Addr: 0x20}
+
+	if err := d.Tx([]byte{0x10, 1, 2, 3}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := rf.Get(0x10, 3); !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Errorf("registers = %v, want [1 2 3]", got)
+	}
+	r := make([]byte, 2)
+	if err := d.Tx([]byte{0x11}, r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, []byte{2, 3}) {
+		t.Errorf("read = %v, want [2 3]", r)
+	}
+
+	// read continues from the register pointer
+	if err := d.Tx(nil, r[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if r[0] != 0 {
+		t.Errorf("read after pointer = %d, want 0", r[0])
+	}
+
+	rf.AutoIncrement = false
+	d.Tx([]byte{0x10}, r)
+	if !bytes.Equal(r, []byte{1, 1}) {
+		t.Errorf("read without auto-increment = %v, want [1 1]", r)
+	}
+}
+
+func TestRegisterFileHooks(t *testing.T) {
+	rf := NewRegisterFile()
+	rf.PointerMask = 0x1F
+	rf.Set(0x12, 0x44)
+	rf.ReadOnly(0x12)
+	var written []byte
+	rf.OnWrite(0x00, func(rf *RegisterFile, reg, v byte) {
+		written = append(written, v)
+		// side effect: power on sets a status bit
+		rf.Regs[0x13] = v & 0x01
+	})
+	reads := 0
+	rf.OnRead(0x14, func(rf *RegisterFile, reg byte) byte {
+		reads++
+		return byte(reads)
+	})
+
+	if err := rf.Tx([]byte{0x80 | 0x12, 0x00}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rf.Regs[0x12] != 0x44 {
+		t.Errorf("read-only register written")
+	}
+	rf.Tx([]byte{0x80, 0x03}, nil)
+	if len(written) != 1 || written[0] != 0x03 || rf.Regs[0x13] != 1 {
+		t.Errorf("write hook not called: %v, status %d", written, rf.Regs[0x13])
+	}
+	r := make([]byte, 3)
+	rf.Tx([]byte{0x80 | 0x13}, r)
+	if !bytes.Equal(r, []byte{1, 1, 0}) {
+		t.Errorf("read = %v, want [1 1 0]", r)
+	}
+
+	e := errors.New("bus error")
+	rf.SetError(e)
+	if err := rf.Tx([]byte{0}, r); err != e {
+		t.Errorf("Tx = %v, want %v", err, e)
+	}
+	rf.SetError(nil)
+	if err := rf.Tx([]byte{0}, r); err != nil {
+		t.Errorf("Tx = %v", err)
+	}
+}
+
+func TestDeviceFunc(t *testing.T) {
+	b := NewBus()
+	b.Attach(0x57, DeviceFunc(func(w, r []byte) error {
+		for i := range r {
+			r[i] = byte(i + 1)
+		}
+		return nil
+	}))
+	r := make([]byte, 3)
+	if err := b.Tx(0x57, nil, r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, []byte{1, 2, 3}) {
+		t.Errorf("read = %v", r)
+	}
+}
@@ -0,0 +1,183 @@
+package sim
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"devices/i2cemu"
+)
+
+// DFR0592 registers.
+const (
+	DFR0592_SLAVE_ADDR      = 0x00
+	DFR0592_PID             = 0x01
+	DFR0592_VID             = 0x02
+	DFR0592_CTRL_MODE       = 0x03
+	DFR0592_ENCODER1_EN     = 0x04
+	DFR0592_ENCODER1_SPEED  = 0x05
+	DFR0592_ENCODER1_RATIO  = 0x07
+	DFR0592_MOTOR_PWM       = 0x0e
+	DFR0592_MOTOR1_ORIENT   = 0x0f
+	DFR0592_MOTOR1_SPEED    = 0x10
+	DFR0592_DEF_PID         = 0xdf
+	DFR0592_DEF_VID         = 0x10
+	DFR0592_ENCODER_SPACING = 5 // encoder 2 registers follow encoder 1
+	DFR0592_MOTOR_SPACING   = 3 // motor 2 registers follow motor 1
+)
+
+// DFR0592 simulates the DFRobot DC motor driver HAT in DC mode with two
+// encoder motors.
+//
+// The motor shaft speed is proportional to the PWM duty cycle, it reaches
+// NoLoadRPM at 100%. The encoder speed registers report the output shaft
+// speed in RPM, that is the motor speed divided by the reduction ratio
+// register, positive when turning clockwise. A non zero TimeConstant gives
+// the motors a first order response, integrated each time the speed is read.
+// A new address takes effect at the next PowerCycle, like on the board.
+type DFR0592 struct {
+	*i2cemu.RegisterFile
+	NoLoadRPM    float64
+	TimeConstant time.Duration
+	Now          func() time.Time
+
+	mu     sync.Mutex
+	speed  [2]float64 // motor shaft RPM
+	update [2]time.Time
+	bus    *i2cemu.Bus
+	addr   uint16
+}
+
+// NewDFR0592 returns a board in its power on state.
+func NewDFR0592() *DFR0592 {
+	s := &DFR0592{
+		RegisterFile: i2cemu.NewRegisterFile(),
+		NoLoadRPM:    7000,
+		Now:          time.Now,
+	}
+	s.reset()
+	s.ReadOnly(DFR0592_PID, DFR0592_VID)
+	for m := 0; m < 2; m++ {
+		reg := byte(DFR0592_ENCODER1_SPEED + m*DFR0592_ENCODER_SPACING)
+		s.ReadOnly(reg, reg+1)
+		m := m
+		s.OnRead(reg, func(rf *i2cemu.RegisterFile, _ byte) byte {
+			return byte(uint16(s.encoderSpeed(rf, m)) >> 8)
+		})
+		s.OnRead(reg+1, func(rf *i2cemu.RegisterFile, _ byte) byte {
+			return byte(uint16(s.encoderSpeed(rf, m)))
+		})
+	}
+	return s
+}
+
+func (s *DFR0592) reset() {
+	s.Do(func(rf *i2cemu.RegisterFile) {
+		addr := rf.Regs[DFR0592_SLAVE_ADDR]
+		rf.Regs = [256]byte{}
+		if addr == 0 {
+			addr = 0x10
+		}
+		// the address is kept in non volatile memory
+		rf.Regs[DFR0592_SLAVE_ADDR] = addr
+		rf.Regs[DFR0592_PID] = DFR0592_DEF_PID
+		rf.Regs[DFR0592_VID] = DFR0592_DEF_VID
+		for m := 0; m < 2; m++ {
+			rf.Regs[DFR0592_MOTOR1_ORIENT+m*DFR0592_MOTOR_SPACING] = 0x05
+		}
+	})
+	s.speed = [2]float64{}
+	s.update = [2]time.Time{}
+}
+
+// Attach connects the board to b at addr, its address register is set
+// accordingly.
+func (s *DFR0592) Attach(b *i2cemu.Bus, addr uint16) error {
+	if err := b.Attach(addr, s); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bus, s.addr = b, addr
+	s.Set(DFR0592_SLAVE_ADDR, byte(addr))
+	return nil
+}
+
+// PowerCycle restarts the board: registers are reset, motors are stopped
+// and a board connected with Attach answers at the address written in the
+// address register.
+func (s *DFR0592) PowerCycle() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	addr := uint16(s.Get(DFR0592_SLAVE_ADDR, 1)[0])
+	if s.bus == nil || addr == s.addr {
+		return nil
+	}
+	if err := s.bus.Move(s.addr, addr); err != nil {
+		return err
+	}
+	s.addr = addr
+	return nil
+}
+
+// Tx implements i2cemu.Device.
+func (s *DFR0592) Tx(w, r []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RegisterFile.Tx(w, r)
+}
+
+// target returns the steady state motor speed of motor m.
+func (s *DFR0592) target(rf *i2cemu.RegisterFile, m int) float64 {
+	reg := DFR0592_MOTOR1_ORIENT + m*DFR0592_MOTOR_SPACING
+	duty := float64(rf.Regs[reg+1]) + float64(rf.Regs[reg+2])/10
+	if duty > 100 {
+		duty = 100
+	}
+	switch rf.Regs[reg] {
+	case 0x01:
+		return duty / 100 * s.NoLoadRPM
+	case 0x02:
+		return -duty / 100 * s.NoLoadRPM
+	}
+	return 0
+}
+
+// motorSpeed updates and returns the motor shaft speed of motor m.
+func (s *DFR0592) motorSpeed(rf *i2cemu.RegisterFile, m int) float64 {
+	now := s.Now()
+	target := s.target(rf, m)
+	if s.TimeConstant <= 0 {
+		s.speed[m] = target
+	} else if !s.update[m].IsZero() {
+		dt := now.Sub(s.update[m]).Seconds()
+		s.speed[m] += (target - s.speed[m]) * (1 - math.Exp(-dt/s.TimeConstant.Seconds()))
+	}
+	s.update[m] = now
+	return s.speed[m]
+}
+
+func (s *DFR0592) encoderSpeed(rf *i2cemu.RegisterFile, m int) int16 {
+	enc := DFR0592_ENCODER1_EN + m*DFR0592_ENCODER_SPACING
+	speed := s.motorSpeed(rf, m)
+	if rf.Regs[enc] == 0 {
+		return 0
+	}
+	ratio := float64(uint16(rf.Regs[enc+3])<<8 | uint16(rf.Regs[enc+4]))
+	if ratio == 0 {
+		ratio = 1
+	}
+	return int16(math.Round(speed / ratio))
+}
+
+// MotorSpeed returns the motor shaft speed in RPM of motor 1 or 2.
+func (s *DFR0592) MotorSpeed(motor int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var speed float64
+	s.RegisterFile.Do(func(rf *i2cemu.RegisterFile) {
+		speed = s.motorSpeed(rf, motor-1)
+	})
+	return speed
+}
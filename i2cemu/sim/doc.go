@@ -0,0 +1,20 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package sim provides simulated boards for the i2cemu bus, modeling the
+// behaviour of the devices supported by this repository, not only their
+// register maps:
+//
+//	DFR0592     DFRobot DC motor driver HAT, encoder speed follows the PWM
+//	PCA9685     PWM controller of the Waveshare motor driver HAT (ws15364)
+//	TCS3472     color sensor, integration time and gain
+//	RCWL9620    M5Stack ultrasonic unit, 20ms measurement
+//	HBridge     M5Stack HBridge unit
+//	ServoUnit   M5Stack 8Servos unit
+//	ExtEncoder  M5Stack external encoder unit
+//	STM32Boot   STM32 I²C bootloader (AN4221) used to flash the M5Stack units
+//
+// Simulators are attached to an i2cemu.Bus like any other device. Time
+// dependent behaviour uses the Now field of each simulator, which defaults
+// to time.Now and can be replaced by tests to control time.
+package sim
@@ -0,0 +1,92 @@
+package sim
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"devices/i2cemu"
+)
+
+// External encoder unit registers.
+const (
+	EXT_ENCODER_ADDR           = 0x59
+	EXT_ENCODER_ENCODER_REG    = 0x00
+	EXT_ENCODER_METER_REG      = 0x10
+	EXT_ENCODER_METER_STR_REG  = 0x20
+	EXT_ENCODER_RESET_REG      = 0x30
+	EXT_ENCODER_PERIMETER_REG  = 0x40
+	EXT_ENCODER_PULSE_REG      = 0x50
+	EXT_ENCODER_ZERO_VALUE_REG = 0x60
+	EXT_ENCODER_ZERO_MODE_REG  = 0x70
+	EXT_ENCODER_ZERO_ENDLESS   = 0
+	EXT_ENCODER_ZERO_RISING    = 1
+	EXT_ENCODER_ZERO_FALLING   = 2
+)
+
+// ExtEncoder simulates the M5Stack external encoder unit.
+//
+// Turn moves the encoder. The meter register is the count times the
+// perimeter divided by the pulses per turn, the meter string holds the same
+// value on 9 digits. Writing 1 to the reset register clears the count and
+// the Z index edge selected by the zero mode loads the zero pulse value.
+type ExtEncoder struct {
+	m5Unit
+}
+
+// NewExtEncoder returns a unit running firmware version fw.
+func NewExtEncoder(fw byte) *ExtEncoder {
+	s := &ExtEncoder{m5Unit: newM5Unit(fw)}
+	for i := byte(0); i < 4; i++ {
+		s.ReadOnly(EXT_ENCODER_ENCODER_REG+i, EXT_ENCODER_METER_REG+i)
+	}
+	for i := byte(0); i < 9; i++ {
+		s.ReadOnly(EXT_ENCODER_METER_STR_REG + i)
+	}
+	s.OnWrite(EXT_ENCODER_RESET_REG, func(rf *i2cemu.RegisterFile, _, v byte) {
+		if v == 1 {
+			setCount(rf, 0)
+		}
+	})
+	s.Do(func(rf *i2cemu.RegisterFile) { setCount(rf, 0) })
+	return s
+}
+
+// Attach connects the unit to b at addr.
+func (s *ExtEncoder) Attach(b *i2cemu.Bus, addr uint16) error {
+	return s.attach(b, addr, s)
+}
+
+// Count returns the encoder count.
+func (s *ExtEncoder) Count() int32 {
+	return int32(binary.LittleEndian.Uint32(s.Get(EXT_ENCODER_ENCODER_REG, 4)))
+}
+
+// Turn adds pulses to the encoder count, negative values turn backward.
+func (s *ExtEncoder) Turn(pulses int32) {
+	s.Do(func(rf *i2cemu.RegisterFile) {
+		c := int32(binary.LittleEndian.Uint32(rf.Regs[EXT_ENCODER_ENCODER_REG:]))
+		setCount(rf, c+pulses)
+	})
+}
+
+// Index simulates an edge of the Z index signal.
+func (s *ExtEncoder) Index(rising bool) {
+	s.Do(func(rf *i2cemu.RegisterFile) {
+		mode := rf.Regs[EXT_ENCODER_ZERO_MODE_REG]
+		if (rising && mode == EXT_ENCODER_ZERO_RISING) || (!rising && mode == EXT_ENCODER_ZERO_FALLING) {
+			setCount(rf, int32(binary.LittleEndian.Uint32(rf.Regs[EXT_ENCODER_ZERO_VALUE_REG:])))
+		}
+	})
+}
+
+func setCount(rf *i2cemu.RegisterFile, c int32) {
+	binary.LittleEndian.PutUint32(rf.Regs[EXT_ENCODER_ENCODER_REG:], uint32(c))
+	perimeter := int64(binary.LittleEndian.Uint32(rf.Regs[EXT_ENCODER_PERIMETER_REG:]))
+	pulses := int64(binary.LittleEndian.Uint32(rf.Regs[EXT_ENCODER_PULSE_REG:]))
+	var meter int64
+	if pulses != 0 {
+		meter = int64(c) * perimeter / pulses
+	}
+	binary.LittleEndian.PutUint32(rf.Regs[EXT_ENCODER_METER_REG:], uint32(meter))
+	copy(rf.Regs[EXT_ENCODER_METER_STR_REG:EXT_ENCODER_METER_STR_REG+9], fmt.Sprintf("%09d", meter%1000000000))
+}
@@ -0,0 +1,77 @@
+package sim
+
+import (
+	"encoding/binary"
+
+	"devices/i2cemu"
+)
+
+// HBridge registers.
+const (
+	HBRIDGE_ADDR           = 0x20
+	HBRIDGE_DIRECTION_REG  = 0x00
+	HBRIDGE_SPEED8_REG     = 0x01
+	HBRIDGE_SPEED16_REG    = 0x02
+	HBRIDGE_PWM_FREQ_REG   = 0x04
+	HBRIDGE_ADC_8BIT_REG   = 0x10
+	HBRIDGE_ADC_12BIT_REG  = 0x20
+	HBRIDGE_CURRENT_REG    = 0x30
+	HBRIDGE_DIRECTION_STOP = 0x00
+)
+
+// HBridge simulates the M5Stack HBridge unit.
+//
+// The 8 and 16 bit speed registers are kept consistent, the 8 bit speed is
+// the high byte of the 16 bit one. The analog input and the motor current are
+// set by the simulation.
+type HBridge struct {
+	m5Unit
+}
+
+// NewHBridge returns a unit running firmware version fw.
+func NewHBridge(fw byte) *HBridge {
+	s := &HBridge{m5Unit: newM5Unit(fw)}
+	s.Set(HBRIDGE_PWM_FREQ_REG, 0xDC, 0x05) // 1500Hz
+	s.ReadOnly(HBRIDGE_ADC_8BIT_REG, HBRIDGE_ADC_12BIT_REG, HBRIDGE_ADC_12BIT_REG+1)
+	for i := byte(0); i < 4; i++ {
+		s.ReadOnly(HBRIDGE_CURRENT_REG + i)
+	}
+	s.OnWrite(HBRIDGE_SPEED8_REG, func(rf *i2cemu.RegisterFile, _, v byte) {
+		rf.Regs[HBRIDGE_SPEED16_REG] = v
+		rf.Regs[HBRIDGE_SPEED16_REG+1] = v
+	})
+	s.OnWrite(HBRIDGE_SPEED16_REG+1, func(rf *i2cemu.RegisterFile, _, v byte) {
+		rf.Regs[HBRIDGE_SPEED8_REG] = v
+	})
+	return s
+}
+
+// Attach connects the unit to b at addr.
+func (s *HBridge) Attach(b *i2cemu.Bus, addr uint16) error {
+	return s.attach(b, addr, s)
+}
+
+// Direction returns the direction register.
+func (s *HBridge) Direction() byte {
+	return s.Get(HBRIDGE_DIRECTION_REG, 1)[0]
+}
+
+// Speed returns the 16 bit speed register.
+func (s *HBridge) Speed() uint16 {
+	return binary.LittleEndian.Uint16(s.Get(HBRIDGE_SPEED16_REG, 2))
+}
+
+// SetAnalogInput sets the 12 bit analog input, the 8 bit register follows.
+func (s *HBridge) SetAnalogInput(v uint16) {
+	s.Do(func(rf *i2cemu.RegisterFile) {
+		binary.LittleEndian.PutUint16(rf.Regs[HBRIDGE_ADC_12BIT_REG:], v&0x0FFF)
+		rf.Regs[HBRIDGE_ADC_8BIT_REG] = byte((v & 0x0FFF) >> 4)
+	})
+}
+
+// SetCurrent sets the motor current in A.
+func (s *HBridge) SetCurrent(a float32) {
+	s.Do(func(rf *i2cemu.RegisterFile) {
+		putFloat32(rf, HBRIDGE_CURRENT_REG, a)
+	})
+}
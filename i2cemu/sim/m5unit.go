@@ -0,0 +1,60 @@
+package sim
+
+import (
+	"encoding/binary"
+	"math"
+
+	"devices/i2cemu"
+)
+
+// Registers shared by the M5Stack units.
+const (
+	M5_JUMP_TO_BOOTLOADER_REG = 0xFD
+	M5_FW_VERSION_REG         = 0xFE
+	M5_I2C_ADDRESS_REG        = 0xFF
+)
+
+// m5Unit holds the firmware version and I2C address registers of the
+// M5Stack units. Writing the address register moves the unit on the bus
+// immediately, like the units do.
+type m5Unit struct {
+	*i2cemu.RegisterFile
+	bus  *i2cemu.Bus
+	addr uint16
+}
+
+func newM5Unit(fw byte) m5Unit {
+	u := m5Unit{RegisterFile: i2cemu.NewRegisterFile()}
+	u.Set(M5_FW_VERSION_REG, fw)
+	u.ReadOnly(M5_FW_VERSION_REG, M5_I2C_ADDRESS_REG)
+	return u
+}
+
+// attach connects the unit, as device d, to b at addr.
+func (u *m5Unit) attach(b *i2cemu.Bus, addr uint16, d i2cemu.Device) error {
+	if err := b.Attach(addr, d); err != nil {
+		return err
+	}
+	u.bus = b
+	u.addr = addr
+	u.Set(M5_I2C_ADDRESS_REG, byte(addr))
+	u.OnWrite(M5_I2C_ADDRESS_REG, func(rf *i2cemu.RegisterFile, _, v byte) {
+		if v < 0x08 || v > 0x77 || u.bus.Move(u.addr, uint16(v)) != nil {
+			return
+		}
+		u.addr = uint16(v)
+		rf.Regs[M5_I2C_ADDRESS_REG] = v
+	})
+	return nil
+}
+
+// Addr returns the current address of the unit.
+func (u *m5Unit) Addr() uint16 {
+	var a uint16
+	u.Do(func(*i2cemu.RegisterFile) { a = u.addr })
+	return a
+}
+
+func putFloat32(rf *i2cemu.RegisterFile, reg byte, v float32) {
+	binary.LittleEndian.PutUint32(rf.Regs[reg:reg+4], math.Float32bits(v))
+}
@@ -0,0 +1,85 @@
+package sim
+
+import (
+	"devices/i2cemu"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// PCA9685 registers.
+const (
+	PCA9685_MODE1       = 0x00
+	PCA9685_MODE2       = 0x01
+	PCA9685_SUBADR1     = 0x02
+	PCA9685_ALLCALLADR  = 0x05
+	PCA9685_LED0_ON_L   = 0x06
+	PCA9685_ALL_LED_ON  = 0xFA
+	PCA9685_PRE_SCALE   = 0xFE
+	PCA9685_MODE1_AI    = 0x20
+	PCA9685_MODE1_SLEEP = 0x10
+	PCA9685_FULL        = 0x10 // full on/off bit of LEDn_ON_H and LEDn_OFF_H
+	PCA9685_OSC         = 25 * physic.MegaHertz
+)
+
+// PCA9685 simulates the 16 channels PWM controller.
+//
+// The register pointer only advances when the MODE1 AI bit is set, the
+// prescaler can only be written while the oscillator is asleep and writes to
+// the ALL_LED registers are copied to every channel.
+type PCA9685 struct {
+	*i2cemu.RegisterFile
+}
+
+// NewPCA9685 returns a controller in its power on state.
+func NewPCA9685() *PCA9685 {
+	s := &PCA9685{RegisterFile: i2cemu.NewRegisterFile()}
+	s.Set(PCA9685_MODE1, 0x11, 0x04)
+	// sub addresses and LED All Call address, in 8 bit form
+	s.Set(PCA9685_SUBADR1, 0xE2, 0xE4, 0xE8, 0xE0)
+	s.Set(PCA9685_PRE_SCALE, 0x1E)
+	for ch := 0; ch < 16; ch++ {
+		// LEDn_OFF_H full off at reset
+		s.Set(byte(PCA9685_LED0_ON_L+4*ch+3), PCA9685_FULL)
+	}
+	s.Next = func(ptr byte) byte {
+		if s.Regs[PCA9685_MODE1]&PCA9685_MODE1_AI != 0 {
+			return ptr + 1
+		}
+		return ptr
+	}
+	s.ReadOnly(PCA9685_PRE_SCALE)
+	s.OnWrite(PCA9685_PRE_SCALE, func(rf *i2cemu.RegisterFile, _, v byte) {
+		if rf.Regs[PCA9685_MODE1]&PCA9685_MODE1_SLEEP != 0 && v >= 3 {
+			rf.Regs[PCA9685_PRE_SCALE] = v
+		}
+	})
+	for i := byte(0); i < 4; i++ {
+		s.OnWrite(PCA9685_ALL_LED_ON+i, func(rf *i2cemu.RegisterFile, reg, v byte) {
+			for ch := 0; ch < 16; ch++ {
+				rf.Regs[PCA9685_LED0_ON_L+4*ch+int(reg-PCA9685_ALL_LED_ON)] = v
+			}
+		})
+	}
+	return s
+}
+
+// Frequency returns the PWM frequency set by the prescaler.
+func (s *PCA9685) Frequency() physic.Frequency {
+	p := s.Get(PCA9685_PRE_SCALE, 1)[0]
+	return PCA9685_OSC / physic.Frequency(4096*(int(p)+1))
+}
+
+// Duty returns the fraction of the period channel ch is high, from 0 to 1.
+// Full off has priority over full on.
+func (s *PCA9685) Duty(ch int) float64 {
+	r := s.Get(byte(PCA9685_LED0_ON_L+4*ch), 4)
+	switch {
+	case r[3]&PCA9685_FULL != 0:
+		return 0
+	case r[1]&PCA9685_FULL != 0:
+		return 1
+	}
+	on := int(r[1]&0x0F)<<8 | int(r[0])
+	off := int(r[3]&0x0F)<<8 | int(r[2])
+	return float64((off-on)&0xFFF) / 4096
+}
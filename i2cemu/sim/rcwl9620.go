@@ -0,0 +1,75 @@
+package sim
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/physic"
+)
+
+// RCWL9620 constants.
+const (
+	RCWL9620_TRIGGER = 0x01
+	RCWL9620_DELAY   = 20 * time.Millisecond
+	RCWL9620_MAX     = 4500 * physic.MilliMetre
+)
+
+// ErrBusy is returned when the device is read during a measurement.
+var ErrBusy = errors.New("sim: device busy")
+
+// RCWL9620 simulates the ultrasonic ranging unit.
+//
+// Writing the trigger command starts a measurement of Distance which lasts
+// RCWL9620_DELAY, reads during a measurement are not acknowledged. The result
+// is read as 3 bytes, big endian, in µm.
+type RCWL9620 struct {
+	Now func() time.Time
+
+	mu       sync.Mutex
+	distance physic.Distance
+	started  time.Time
+	result   uint32
+}
+
+// NewRCWL9620 returns a sensor measuring d.
+func NewRCWL9620(d physic.Distance) *RCWL9620 {
+	return &RCWL9620{Now: time.Now, distance: d}
+}
+
+// SetDistance changes the distance of the obstacle.
+func (s *RCWL9620) SetDistance(d physic.Distance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.distance = d
+}
+
+// Tx implements i2cemu.Device.
+func (s *RCWL9620) Tx(w, r []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Now()
+	if len(w) > 0 && w[0] == RCWL9620_TRIGGER {
+		s.started = now
+		d := s.distance
+		if d > RCWL9620_MAX {
+			d = RCWL9620_MAX
+		}
+		s.result = uint32(d / physic.MicroMetre)
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	if !s.started.IsZero() && now.Sub(s.started) < RCWL9620_DELAY {
+		return ErrBusy
+	}
+	v := [3]byte{byte(s.result >> 16), byte(s.result >> 8), byte(s.result)}
+	for i := range r {
+		if i < len(v) {
+			r[i] = v[i]
+		} else {
+			r[i] = 0
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package sim
+
+import (
+	"encoding/binary"
+
+	"devices/i2cemu"
+)
+
+// 8Servos unit registers.
+const (
+	SERVO_UNIT_ADDR          = 0x25
+	SERVO_UNIT_MODE_REG      = 0x00
+	SERVO_UNIT_OUTPUT_REG    = 0x10
+	SERVO_UNIT_INPUT_REG     = 0x20
+	SERVO_UNIT_ADC_8BIT_REG  = 0x30
+	SERVO_UNIT_ADC_12BIT_REG = 0x40
+	SERVO_UNIT_ANGLE_REG     = 0x50
+	SERVO_UNIT_PULSE_REG     = 0x60
+	SERVO_UNIT_RGB_REG       = 0x70
+	SERVO_UNIT_PWM_REG       = 0x90
+	SERVO_UNIT_CURRENT_REG   = 0xA0
+	SERVO_UNIT_PINS          = 8
+	SERVO_UNIT_MIN_PULSE     = 500  // µs at 0°
+	SERVO_UNIT_MAX_PULSE     = 2500 // µs at 180°
+)
+
+// ServoUnit simulates the M5Stack 8Servos unit.
+//
+// Writing a servo angle updates the pulse width register of the pin, from
+// 500µs at 0° to 2500µs at 180°. Inputs and current are set by the
+// simulation.
+type ServoUnit struct {
+	m5Unit
+}
+
+// NewServoUnit returns a unit running firmware version fw.
+func NewServoUnit(fw byte) *ServoUnit {
+	s := &ServoUnit{m5Unit: newM5Unit(fw)}
+	for pin := byte(0); pin < SERVO_UNIT_PINS; pin++ {
+		s.ReadOnly(SERVO_UNIT_INPUT_REG+pin, SERVO_UNIT_ADC_8BIT_REG+pin,
+			SERVO_UNIT_ADC_12BIT_REG+2*pin, SERVO_UNIT_ADC_12BIT_REG+2*pin+1)
+		s.OnWrite(SERVO_UNIT_ANGLE_REG+pin, func(rf *i2cemu.RegisterFile, reg, v byte) {
+			if v > 180 {
+				v = 180
+			}
+			pulse := uint16(SERVO_UNIT_MIN_PULSE + int(v)*(SERVO_UNIT_MAX_PULSE-SERVO_UNIT_MIN_PULSE)/180)
+			binary.LittleEndian.PutUint16(rf.Regs[SERVO_UNIT_PULSE_REG+2*(reg-SERVO_UNIT_ANGLE_REG):], pulse)
+		})
+	}
+	for i := byte(0); i < 4; i++ {
+		s.ReadOnly(SERVO_UNIT_CURRENT_REG + i)
+	}
+	return s
+}
+
+// Attach connects the unit to b at addr.
+func (s *ServoUnit) Attach(b *i2cemu.Bus, addr uint16) error {
+	return s.attach(b, addr, s)
+}
+
+// Mode returns the mode register of pin.
+func (s *ServoUnit) Mode(pin byte) byte {
+	return s.Get(SERVO_UNIT_MODE_REG+pin, 1)[0]
+}
+
+// Pulse returns the servo pulse width of pin in µs.
+func (s *ServoUnit) Pulse(pin byte) uint16 {
+	return binary.LittleEndian.Uint16(s.Get(SERVO_UNIT_PULSE_REG+2*pin, 2))
+}
+
+// Output returns the digital output register of pin.
+func (s *ServoUnit) Output(pin byte) byte {
+	return s.Get(SERVO_UNIT_OUTPUT_REG+pin, 1)[0]
+}
+
+// SetDigitalInput sets the level read on pin.
+func (s *ServoUnit) SetDigitalInput(pin byte, high bool) {
+	v := byte(0)
+	if high {
+		v = 1
+	}
+	s.Set(SERVO_UNIT_INPUT_REG+pin, v)
+}
+
+// SetAnalogInput sets the 12 bit analog input of pin, the 8 bit register follows.
+func (s *ServoUnit) SetAnalogInput(pin byte, v uint16) {
+	s.Do(func(rf *i2cemu.RegisterFile) {
+		binary.LittleEndian.PutUint16(rf.Regs[SERVO_UNIT_ADC_12BIT_REG+2*pin:], v&0x0FFF)
+		rf.Regs[SERVO_UNIT_ADC_8BIT_REG+pin] = byte((v & 0x0FFF) >> 4)
+	})
+}
+
+// SetCurrent sets the servo supply current in A.
+func (s *ServoUnit) SetCurrent(a float32) {
+	s.Do(func(rf *i2cemu.RegisterFile) {
+		putFloat32(rf, SERVO_UNIT_CURRENT_REG, a)
+	})
+}
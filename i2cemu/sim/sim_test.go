@@ -0,0 +1,245 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"devices/i2cemu"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/physic"
+)
+
+var (
+	_ i2cemu.Device = &DFR0592{}
+	_ i2cemu.Device = &PCA9685{}
+	_ i2cemu.Device = &TCS3472{}
+	_ i2cemu.Device = &RCWL9620{}
+	_ i2cemu.Device = &HBridge{}
+	_ i2cemu.Device = &ServoUnit{}
+	_ i2cemu.Device = &ExtEncoder{}
+)
+
+func read(t *testing.T, d i2c.Dev, reg byte, n int) []byte {
+	r := make([]byte, n)
+	if err := d.Tx([]byte{reg}, r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDFR0592(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := NewDFR0592()
+	now := time.Unix(0, 0)
+	s.Now = func() time.Time { return now }
+	s.TimeConstant = 100 * time.Millisecond
+	b.Attach(0x10, s)
+	d := i2c.Dev{Bus: b, Addr: 0x10}
+
+	if id := read(t, d, DFR0592_PID, 2); id[0] != 0xDF || id[1] != 0x10 {
+		t.Errorf("PID/VID = %v", id)
+	}
+	d.Tx([]byte{DFR0592_PID, 0}, nil)
+	if id := read(t, d, DFR0592_PID, 1); id[0] != 0xDF {
+		t.Errorf("PID written")
+	}
+	// encoder 1 enabled, reduction ratio 50, motor 1 clockwise at 50%
+	d.Tx([]byte{DFR0592_ENCODER1_EN, 1}, nil)
+	d.Tx([]byte{DFR0592_ENCODER1_RATIO, 0, 50}, nil)
+	d.Tx([]byte{DFR0592_MOTOR1_ORIENT, 0x01, 50, 0}, nil)
+	if v := read(t, d, DFR0592_ENCODER1_SPEED, 2); v[0] != 0 || v[1] != 0 {
+		t.Errorf("speed at start = %v, want 0", v)
+	}
+	now = now.Add(time.Second)
+	if v := read(t, d, DFR0592_ENCODER1_SPEED, 2); v[0] != 0 || v[1] != 70 {
+		t.Errorf("speed = %v, want 70 RPM", v)
+	}
+	// counter clockwise
+	d.Tx([]byte{DFR0592_MOTOR1_ORIENT, 0x02}, nil)
+	now = now.Add(2 * time.Second)
+	if v := read(t, d, DFR0592_ENCODER1_SPEED, 2); int16(uint16(v[0])<<8|uint16(v[1])) != -70 {
+		t.Errorf("speed = %v, want -70 RPM", v)
+	}
+	if rpm := s.MotorSpeed(1); rpm > -3499 {
+		t.Errorf("MotorSpeed(1) = %f", rpm)
+	}
+	// encoder 2 disabled
+	if v := read(t, d, DFR0592_ENCODER1_SPEED+DFR0592_ENCODER_SPACING, 2); v[0] != 0 || v[1] != 0 {
+		t.Errorf("encoder 2 speed = %v", v)
+	}
+}
+
+func TestPCA9685(t *testing.T) {
+	s := NewPCA9685()
+	d := i2c.Dev{Bus: i2cemu.NewBus(), Addr: 0x40}
+	d.Bus.(*i2cemu.Bus).Attach(0x40, s)
+
+	// prescale ignored while awake
+	d.Tx([]byte{PCA9685_MODE1, 0x01}, nil)
+	d.Tx([]byte{PCA9685_PRE_SCALE, 0x03}, nil)
+	if p := s.Get(PCA9685_PRE_SCALE, 1); p[0] != 0x1E {
+		t.Errorf("prescale written while awake: 0x%02x", p[0])
+	}
+	d.Tx([]byte{PCA9685_MODE1, PCA9685_MODE1_SLEEP}, nil)
+	d.Tx([]byte{PCA9685_PRE_SCALE, 0x79}, nil)
+	if f := s.Frequency(); f < 49*physic.Hertz || f > 51*physic.Hertz {
+		t.Errorf("Frequency() = %s, want 50Hz", f)
+	}
+
+	// no auto-increment: all bytes go to LED0_ON_L
+	d.Tx([]byte{PCA9685_LED0_ON_L, 1, 2, 3}, nil)
+	if r := s.Get(PCA9685_LED0_ON_L, 2); r[0] != 3 || r[1] != 0 {
+		t.Errorf("LED0 = %v", r)
+	}
+	d.Tx([]byte{PCA9685_MODE1, PCA9685_MODE1_AI}, nil)
+	d.Tx([]byte{PCA9685_LED0_ON_L + 4, 0, 0, 0x00, 0x08}, nil)
+	if duty := s.Duty(1); duty != 0.5 {
+		t.Errorf("Duty(1) = %f, want 0.5", duty)
+	}
+	d.Tx([]byte{PCA9685_ALL_LED_ON, 0, PCA9685_FULL, 0, 0}, nil)
+	for ch := 0; ch < 16; ch++ {
+		if duty := s.Duty(ch); duty != 1 {
+			t.Errorf("Duty(%d) = %f after ALL_LED full on", ch, duty)
+		}
+	}
+}
+
+func TestTCS3472(t *testing.T) {
+	s := NewTCS3472()
+	now := time.Unix(0, 0)
+	s.Now = func() time.Time { return now }
+	s.SetLight(2000, 0, 0, 0)
+
+	s.Tx([]byte{TCS3472_COMMAND | TCS3472_ATIME, 0xC0}, nil) // 64 cycles
+	s.Tx([]byte{TCS3472_COMMAND | TCS3472_ENABLE, TCS3472_PON | TCS3472_AEN}, nil)
+	if it := s.IntegrationTime(); it != 153600*time.Microsecond {
+		t.Errorf("IntegrationTime() = %s", it)
+	}
+	now = now.Add(200 * time.Millisecond)
+	r := make([]byte, 2)
+	s.Tx([]byte{TCS3472_COMMAND | TCS3472_STATUS}, r[:1])
+	if r[0]&TCS3472_AVALID == 0 {
+		t.Errorf("status = 0x%02x", r[0])
+	}
+	// saturated clear channel
+	s.Tx([]byte{TCS3472_COMMAND | TCS3472_CDATAL}, r)
+	if r[0] != 0xFF || r[1] != 0xFF {
+		t.Errorf("clear = %v, want 65535", r)
+	}
+	s.Tx([]byte{TCS3472_COMMAND | TCS3472_ENABLE, 0}, nil)
+	s.Tx([]byte{TCS3472_COMMAND | TCS3472_STATUS}, r[:1])
+	if r[0]&TCS3472_AVALID != 0 {
+		t.Errorf("AVALID set after disable")
+	}
+}
+
+func TestRCWL9620(t *testing.T) {
+	s := NewRCWL9620(123456 * physic.MicroMetre)
+	now := time.Unix(0, 0)
+	s.Now = func() time.Time { return now }
+	r := make([]byte, 3)
+	s.Tx([]byte{RCWL9620_TRIGGER}, nil)
+	if err := s.Tx(nil, r); !errors.Is(err, ErrBusy) {
+		t.Errorf("read during measurement = %v, want %v", err, ErrBusy)
+	}
+	now = now.Add(RCWL9620_DELAY)
+	if err := s.Tx(nil, r); err != nil || !bytes.Equal(r, []byte{0x01, 0xE2, 0x40}) {
+		t.Errorf("read = %v, %v", r, err)
+	}
+	s.SetDistance(10 * physic.Metre)
+	s.Tx([]byte{RCWL9620_TRIGGER}, nil)
+	now = now.Add(RCWL9620_DELAY)
+	s.Tx(nil, r)
+	if v := uint32(r[0])<<16 | uint32(r[1])<<8 | uint32(r[2]); v != 4500000 {
+		t.Errorf("out of range distance = %dµm", v)
+	}
+}
+
+func TestHBridge(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := NewHBridge(2)
+	if err := s.Attach(b, HBRIDGE_ADDR); err != nil {
+		t.Fatal(err)
+	}
+	d := i2c.Dev{Bus: b, Addr: HBRIDGE_ADDR}
+	d.Tx([]byte{HBRIDGE_SPEED8_REG, 0x80}, nil)
+	if v := s.Speed(); v != 0x8080 {
+		t.Errorf("Speed() = 0x%04x", v)
+	}
+	d.Tx([]byte{HBRIDGE_SPEED16_REG, 0x00, 0x40}, nil)
+	if v := read(t, d, HBRIDGE_SPEED8_REG, 1); v[0] != 0x40 {
+		t.Errorf("8 bit speed = 0x%02x", v[0])
+	}
+	s.SetAnalogInput(0xABC)
+	if v := read(t, d, HBRIDGE_ADC_8BIT_REG, 1); v[0] != 0xAB {
+		t.Errorf("8 bit ADC = 0x%02x", v[0])
+	}
+	if v := read(t, d, M5_FW_VERSION_REG, 2); v[0] != 2 || v[1] != HBRIDGE_ADDR {
+		t.Errorf("version/address = %v", v)
+	}
+
+	// address change moves the unit
+	d.Tx([]byte{M5_I2C_ADDRESS_REG, 0x21}, nil)
+	if s.Addr() != 0x21 || b.Device(0x21) != s || b.Device(HBRIDGE_ADDR) != nil {
+		t.Errorf("unit not moved to 0x21")
+	}
+	d.Addr = 0x21
+	d.Tx([]byte{M5_I2C_ADDRESS_REG, 0x01}, nil)
+	if v := read(t, d, M5_I2C_ADDRESS_REG, 1); v[0] != 0x21 {
+		t.Errorf("invalid address accepted: 0x%02x", v[0])
+	}
+}
+
+func TestServoUnit(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := NewServoUnit(1)
+	s.Attach(b, SERVO_UNIT_ADDR)
+	d := i2c.Dev{Bus: b, Addr: SERVO_UNIT_ADDR}
+	d.Tx([]byte{SERVO_UNIT_ANGLE_REG + 3, 90}, nil)
+	if p := s.Pulse(3); p != 1500 {
+		t.Errorf("Pulse(3) = %d, want 1500", p)
+	}
+	s.SetDigitalInput(2, true)
+	d.Tx([]byte{SERVO_UNIT_INPUT_REG + 2, 0}, nil)
+	if v := read(t, d, SERVO_UNIT_INPUT_REG+2, 1); v[0] != 1 {
+		t.Errorf("input 2 = %d", v[0])
+	}
+	s.SetAnalogInput(7, 0x123)
+	if v := read(t, d, SERVO_UNIT_ADC_12BIT_REG+14, 2); v[0] != 0x23 || v[1] != 0x01 {
+		t.Errorf("analog input 7 = %v", v)
+	}
+}
+
+func TestExtEncoder(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := NewExtEncoder(1)
+	s.Attach(b, EXT_ENCODER_ADDR)
+	d := i2c.Dev{Bus: b, Addr: EXT_ENCODER_ADDR}
+	// 1000 pulses per 314 perimeter
+	d.Tx([]byte{EXT_ENCODER_PERIMETER_REG, 0x3A, 0x01, 0, 0}, nil)
+	d.Tx([]byte{EXT_ENCODER_PULSE_REG, 0xE8, 0x03, 0, 0}, nil)
+	s.Turn(2500)
+	if v := read(t, d, EXT_ENCODER_METER_REG, 4); v[0] != 0x11 || v[1] != 0x03 {
+		t.Errorf("meter = %v, want 785", v)
+	}
+	if v := read(t, d, EXT_ENCODER_METER_STR_REG, 9); string(v) != "000000785" {
+		t.Errorf("meter string = %q", v)
+	}
+	d.Tx([]byte{EXT_ENCODER_ZERO_VALUE_REG, 10, 0, 0, 0}, nil)
+	d.Tx([]byte{EXT_ENCODER_ZERO_MODE_REG, EXT_ENCODER_ZERO_RISING}, nil)
+	s.Index(false)
+	if c := s.Count(); c != 2500 {
+		t.Errorf("Count() = %d after falling edge", c)
+	}
+	s.Index(true)
+	if c := s.Count(); c != 10 {
+		t.Errorf("Count() = %d after rising edge, want 10", c)
+	}
+	d.Tx([]byte{EXT_ENCODER_RESET_REG, 1}, nil)
+	if c := s.Count(); c != 0 {
+		t.Errorf("Count() = %d after reset", c)
+	}
+}
@@ -0,0 +1,212 @@
+package sim
+
+import (
+	"sync"
+)
+
+// STM32 I2C bootloader bytes and commands, from ST AN4221.
+const (
+	STM32BOOT_ACK            = 0x79
+	STM32BOOT_NACK           = 0x1F
+	STM32BOOT_GET            = 0x00
+	STM32BOOT_GET_ID         = 0x02
+	STM32BOOT_READ_MEMORY    = 0x11
+	STM32BOOT_GO             = 0x21
+	STM32BOOT_WRITE_MEMORY   = 0x31
+	STM32BOOT_EXTENDED_ERASE = 0x44
+	STM32BOOT_FLASH_BASE     = 0x08000000
+)
+
+// STM32Boot simulates the I2C bootloader of an STM32 microcontroller.
+//
+// It answers the Get, Get ID, Read Memory, Go, Write Memory and Extended
+// Erase commands. Writes can only clear bits like flash memory does, so a
+// page must be erased before it is written. The first Protected bytes of the
+// flash hold the bootloader, writing or erasing them is refused. Replies are
+// queued and returned by the following reads, a read with nothing queued
+// returns NACK.
+type STM32Boot struct {
+	mu        sync.Mutex
+	Flash     []byte // from STM32BOOT_FLASH_BASE
+	PageSize  int
+	Protected int
+	PID       uint16
+	Version   byte
+	// Started is the address given to the Go command, 0 until then.
+	Started uint32
+
+	out   []byte
+	state byte // command waiting for its next frame, 0xFF when idle
+	stage int
+	addr  uint32
+}
+
+// NewSTM32Boot returns a bootloader with size bytes of erased flash.
+func NewSTM32Boot(size, pageSize int) *STM32Boot {
+	s := &STM32Boot{
+		Flash:    make([]byte, size),
+		PageSize: pageSize,
+		PID:      0x0444, // STM32F03x
+		Version:  0x10,
+		state:    0xFF,
+	}
+	for i := range s.Flash {
+		s.Flash[i] = 0xFF
+	}
+	return s
+}
+
+func xor(b []byte) byte {
+	var x byte
+	for _, v := range b {
+		x ^= v
+	}
+	return x
+}
+
+// offset returns the flash offset of addr for n bytes, -1 when out of flash.
+func (s *STM32Boot) offset(addr uint32, n int) int {
+	if addr < STM32BOOT_FLASH_BASE || int(addr-STM32BOOT_FLASH_BASE)+n > len(s.Flash) {
+		return -1
+	}
+	return int(addr - STM32BOOT_FLASH_BASE)
+}
+
+// Tx implements i2cemu.Device.
+func (s *STM32Boot) Tx(w, r []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(w) > 0 {
+		s.write(w)
+	}
+	for i := range r {
+		if len(s.out) == 0 {
+			r[i] = STM32BOOT_NACK
+			continue
+		}
+		r[i] = s.out[0]
+		s.out = s.out[1:]
+	}
+	return nil
+}
+
+func (s *STM32Boot) reply(b ...byte) {
+	s.out = append(s.out, b...)
+}
+
+func (s *STM32Boot) fail() {
+	s.state = 0xFF
+	s.reply(STM32BOOT_NACK)
+}
+
+func (s *STM32Boot) write(w []byte) {
+	if s.state == 0xFF {
+		if len(w) != 2 || w[1] != ^w[0] {
+			s.fail()
+			return
+		}
+		switch w[0] {
+		case STM32BOOT_GET:
+			cmds := []byte{STM32BOOT_GET, STM32BOOT_GET_ID, STM32BOOT_READ_MEMORY, STM32BOOT_GO, STM32BOOT_WRITE_MEMORY, STM32BOOT_EXTENDED_ERASE}
+			s.reply(STM32BOOT_ACK, byte(len(cmds)), s.Version)
+			s.reply(cmds...)
+			s.reply(STM32BOOT_ACK)
+		case STM32BOOT_GET_ID:
+			s.reply(STM32BOOT_ACK, 1, byte(s.PID>>8), byte(s.PID), STM32BOOT_ACK)
+		case STM32BOOT_READ_MEMORY, STM32BOOT_GO, STM32BOOT_WRITE_MEMORY, STM32BOOT_EXTENDED_ERASE:
+			s.state, s.stage = w[0], 0
+			s.reply(STM32BOOT_ACK)
+		default:
+			s.fail()
+		}
+		return
+	}
+
+	if s.stage == 0 && s.state != STM32BOOT_EXTENDED_ERASE {
+		// address frame
+		if len(w) != 5 || xor(w[:4]) != w[4] {
+			s.fail()
+			return
+		}
+		s.addr = uint32(w[0])<<24 | uint32(w[1])<<16 | uint32(w[2])<<8 | uint32(w[3])
+		if s.state == STM32BOOT_GO {
+			s.Started = s.addr
+			s.state = 0xFF
+			s.reply(STM32BOOT_ACK)
+			return
+		}
+		s.stage = 1
+		s.reply(STM32BOOT_ACK)
+		return
+	}
+
+	cmd := s.state
+	s.state = 0xFF
+	switch cmd {
+	case STM32BOOT_READ_MEMORY:
+		if len(w) != 2 || w[1] != ^w[0] {
+			s.fail()
+			return
+		}
+		n := int(w[0]) + 1
+		off := s.offset(s.addr, n)
+		if off < 0 {
+			s.fail()
+			return
+		}
+		s.reply(STM32BOOT_ACK)
+		s.reply(s.Flash[off : off+n]...)
+	case STM32BOOT_WRITE_MEMORY:
+		n := int(w[0]) + 1
+		if len(w) != n+2 || n%4 != 0 || xor(w[:n+1]) != w[n+1] {
+			s.fail()
+			return
+		}
+		off := s.offset(s.addr, n)
+		if off < s.Protected || s.addr%4 != 0 {
+			s.fail()
+			return
+		}
+		for i, v := range w[1 : n+1] {
+			s.Flash[off+i] &= v
+		}
+		s.reply(STM32BOOT_ACK)
+	case STM32BOOT_EXTENDED_ERASE:
+		if len(w) < 3 || xor(w[:len(w)-1]) != w[len(w)-1] {
+			s.fail()
+			return
+		}
+		n := int(w[0])<<8 | int(w[1])
+		// mass and bank erases are not supported, they would erase the bootloader
+		if n >= 0xFFF0 || len(w) != 2+2*(n+1)+1 {
+			s.fail()
+			return
+		}
+		pages := w[2 : len(w)-1]
+		for i := 0; i < len(pages); i += 2 {
+			off := (int(pages[i])<<8 | int(pages[i+1])) * s.PageSize
+			if off < s.Protected || off+s.PageSize > len(s.Flash) {
+				s.fail()
+				return
+			}
+		}
+		for i := 0; i < len(pages); i += 2 {
+			off := (int(pages[i])<<8 | int(pages[i+1])) * s.PageSize
+			for j := off; j < off+s.PageSize; j++ {
+				s.Flash[j] = 0xFF
+			}
+		}
+		s.reply(STM32BOOT_ACK)
+	}
+}
+
+// Image returns a copy of n bytes of flash from addr.
+func (s *STM32Boot) Image(addr uint32, n int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	off := s.offset(addr, n)
+	if off < 0 {
+		return nil
+	}
+	return append([]byte(nil), s.Flash[off:off+n]...)
+}
@@ -0,0 +1,139 @@
+package sim
+
+import (
+	"sync"
+	"time"
+
+	"devices/i2cemu"
+)
+
+// TCS3472 registers and bits.
+const (
+	TCS3472_COMMAND    = 0x80
+	TCS3472_ENABLE     = 0x00
+	TCS3472_ATIME      = 0x01
+	TCS3472_CONTROL    = 0x0F
+	TCS3472_ID         = 0x12
+	TCS3472_STATUS     = 0x13
+	TCS3472_CDATAL     = 0x14
+	TCS3472_PON        = 0x01
+	TCS3472_AEN        = 0x02
+	TCS3472_AVALID     = 0x01
+	TCS3472_CYCLE      = 2400 * time.Microsecond
+	TCS34725_ID        = 0x44
+	tcs3472DataEnd     = TCS3472_CDATAL + 8
+	tcs3472CountsCycle = 1024
+)
+
+var tcs3472Gains = [4]float64{1, 4, 16, 60}
+
+// TCS3472 simulates the color sensor.
+//
+// Light is the count rate of the clear, red, green and blue channels per
+// integration cycle of 2.4ms at 1x gain. Once PON and AEN are set, a result
+// is available at the end of each integration: AVALID is set and the data
+// registers hold the light scaled by the number of cycles and the gain,
+// saturated at the maximum count of the integration time.
+//
+// The register pointer advances after each byte whatever the command type,
+// as the driver expects from its multi-byte reads. Reading the low byte of
+// a channel latches its high byte.
+type TCS3472 struct {
+	*i2cemu.RegisterFile
+	Now func() time.Time
+
+	mu    sync.Mutex
+	light [4]float64
+	start time.Time
+	latch byte
+}
+
+// NewTCS3472 returns a TCS34725 in its power on state.
+func NewTCS3472() *TCS3472 {
+	s := &TCS3472{RegisterFile: i2cemu.NewRegisterFile(), Now: time.Now}
+	s.PointerMask = 0x1F
+	s.Set(TCS3472_ATIME, 0xFF)
+	s.Set(TCS3472_ID, TCS34725_ID)
+	s.ReadOnly(TCS3472_ID, TCS3472_STATUS)
+	for r := byte(TCS3472_CDATAL); r < tcs3472DataEnd; r++ {
+		s.ReadOnly(r)
+	}
+	s.Next = func(ptr byte) byte {
+		return (ptr + 1) & 0x1F
+	}
+	s.OnWrite(TCS3472_ENABLE, func(rf *i2cemu.RegisterFile, _, v byte) {
+		if v&(TCS3472_PON|TCS3472_AEN) == TCS3472_PON|TCS3472_AEN {
+			if s.start.IsZero() {
+				s.start = s.Now()
+			}
+		} else {
+			s.start = time.Time{}
+			rf.Regs[TCS3472_STATUS] &^= TCS3472_AVALID
+		}
+	})
+	s.OnRead(TCS3472_STATUS, func(rf *i2cemu.RegisterFile, _ byte) byte {
+		s.integrate(rf)
+		return rf.Regs[TCS3472_STATUS]
+	})
+	for r := byte(TCS3472_CDATAL); r < tcs3472DataEnd; r += 2 {
+		s.OnRead(r, func(rf *i2cemu.RegisterFile, reg byte) byte {
+			s.integrate(rf)
+			s.latch = rf.Regs[reg+1]
+			return rf.Regs[reg]
+		})
+		s.OnRead(r+1, func(rf *i2cemu.RegisterFile, reg byte) byte {
+			return s.latch
+		})
+	}
+	return s
+}
+
+// Tx implements i2cemu.Device.
+func (s *TCS3472) Tx(w, r []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RegisterFile.Tx(w, r)
+}
+
+// SetLight sets the clear, red, green and blue counts per cycle at 1x gain.
+func (s *TCS3472) SetLight(clear, red, green, blue float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.light = [4]float64{clear, red, green, blue}
+}
+
+// IntegrationTime returns the integration time set by ATIME.
+func (s *TCS3472) IntegrationTime() time.Duration {
+	return time.Duration(s.cycles(s.Get(TCS3472_ATIME, 1)[0])) * TCS3472_CYCLE
+}
+
+func (s *TCS3472) cycles(atime byte) int {
+	return 256 - int(atime)
+}
+
+// integrate updates the data registers if an integration completed since
+// the enable.
+func (s *TCS3472) integrate(rf *i2cemu.RegisterFile) {
+	if s.start.IsZero() {
+		return
+	}
+	cycles := s.cycles(rf.Regs[TCS3472_ATIME])
+	if s.Now().Sub(s.start) < time.Duration(cycles)*TCS3472_CYCLE {
+		return
+	}
+	max := float64(cycles * tcs3472CountsCycle)
+	if max > 65535 {
+		max = 65535
+	}
+	gain := tcs3472Gains[rf.Regs[TCS3472_CONTROL]&0x03]
+	for i, l := range s.light {
+		c := l * float64(cycles) * gain
+		if c > max {
+			c = max
+		}
+		v := uint16(c)
+		rf.Regs[TCS3472_CDATAL+2*i] = byte(v)
+		rf.Regs[TCS3472_CDATAL+2*i+1] = byte(v >> 8)
+	}
+	rf.Regs[TCS3472_STATUS] |= TCS3472_AVALID
+}
@@ -0,0 +1,16 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package i2ctrace records the I²C transactions of any driver to a compact
+// file and replays them without the hardware.
+//
+// A Recorder wraps the real bus given to a driver in the field. The trace can
+// then be read back with a Reader and served to the same driver by a Replay
+// bus on a desk.
+//
+// File format: the magic "I2CT", a version byte and the start time in
+// nanoseconds since the Unix epoch as a varint. Each transaction follows as
+// uvarints: the time since the previous transaction in µs, the address, the
+// write length and bytes, the read length and bytes, the error message length
+// and message.
+package i2ctrace
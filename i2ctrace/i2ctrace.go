@@ -0,0 +1,293 @@
+package i2ctrace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/physic"
+)
+
+const (
+	magic   = "I2CT"
+	version = 1
+)
+
+// ErrMismatch is returned by Replay when a transaction differs from the trace.
+var ErrMismatch = errors.New("i2ctrace: transaction does not match the trace")
+
+// Entry is one recorded transaction.
+type Entry struct {
+	Time time.Time
+	Addr uint16
+	W    []byte
+	R    []byte
+	Err  string // empty when the transaction succeeded
+}
+
+func (e Entry) String() string {
+	s := fmt.Sprintf("%s 0x%02x W:% x R:% x", e.Time.Format("15:04:05.000000"), e.Addr, e.W, e.R)
+	if e.Err != "" {
+		s += " error: " + e.Err
+	}
+	return s
+}
+
+// Recorder is an i2c.Bus recording every transaction of the underlying bus.
+type Recorder struct {
+	bus i2c.Bus
+
+	mu   sync.Mutex
+	w    *bufio.Writer
+	last time.Time
+	err  error
+}
+
+// NewRecorder writes the trace of bus to w.
+func NewRecorder(bus i2c.Bus, w io.Writer) (*Recorder, error) {
+	r := &Recorder{bus: bus, w: bufio.NewWriter(w), last: time.Now()}
+	r.w.WriteString(magic)
+	r.w.WriteByte(version)
+	r.putVarint(r.last.UnixNano())
+	if err := r.w.Flush(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) String() string {
+	return "record(" + r.bus.String() + ")"
+}
+
+// Tx implements i2c.Bus, the transaction is recorded whatever its result.
+func (r *Recorder) Tx(addr uint16, w, rd []byte) error {
+	err := r.bus.Tx(addr, w, rd)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.putUvarint(uint64(now.Sub(r.last) / time.Microsecond))
+	r.last = r.last.Add(now.Sub(r.last) / time.Microsecond * time.Microsecond)
+	r.putUvarint(uint64(addr))
+	r.putBytes(w)
+	r.putBytes(rd)
+	if err != nil {
+		r.putBytes([]byte(err.Error()))
+	} else {
+		r.putUvarint(0)
+	}
+	return err
+}
+
+// SetSpeed implements i2c.Bus.
+func (r *Recorder) SetSpeed(f physic.Frequency) error {
+	return r.bus.SetSpeed(f)
+}
+
+// Flush writes buffered transactions and returns the first write error.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// Close flushes the trace. The underlying bus is not closed.
+func (r *Recorder) Close() error {
+	return r.Flush()
+}
+
+func (r *Recorder) putUvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	r.write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (r *Recorder) putVarint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	r.write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func (r *Recorder) putBytes(b []byte) {
+	r.putUvarint(uint64(len(b)))
+	r.write(b)
+}
+
+func (r *Recorder) write(b []byte) {
+	if _, err := r.w.Write(b); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// Reader reads a trace.
+type Reader struct {
+	r    *bufio.Reader
+	last time.Time
+}
+
+// NewReader checks the trace header.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r)}
+	h := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(rd.r, h); err != nil {
+		return nil, fmt.Errorf("i2ctrace: reading header: %v", err)
+	}
+	if string(h[:len(magic)]) != magic {
+		return nil, fmt.Errorf("i2ctrace: not a trace file")
+	}
+	if h[len(magic)] != version {
+		return nil, fmt.Errorf("i2ctrace: unsupported version %d", h[len(magic)])
+	}
+	start, err := binary.ReadVarint(rd.r)
+	if err != nil {
+		return nil, fmt.Errorf("i2ctrace: reading header: %v", err)
+	}
+	rd.last = time.Unix(0, start)
+	return rd, nil
+}
+
+// Next returns the next transaction, or io.EOF at the end of the trace.
+func (rd *Reader) Next() (Entry, error) {
+	var e Entry
+	dt, err := binary.ReadUvarint(rd.r)
+	if err != nil {
+		return e, err
+	}
+	rd.last = rd.last.Add(time.Duration(dt) * time.Microsecond)
+	e.Time = rd.last
+	addr, err := binary.ReadUvarint(rd.r)
+	if err != nil {
+		return e, truncated(err)
+	}
+	e.Addr = uint16(addr)
+	if e.W, err = rd.bytes(); err != nil {
+		return e, truncated(err)
+	}
+	if e.R, err = rd.bytes(); err != nil {
+		return e, truncated(err)
+	}
+	msg, err := rd.bytes()
+	if err != nil {
+		return e, truncated(err)
+	}
+	e.Err = string(msg)
+	return e, nil
+}
+
+func (rd *Reader) bytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(rd.r)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if n > 1<<16 {
+		return nil, fmt.Errorf("i2ctrace: invalid length %d", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(rd.r, b)
+	return b, err
+}
+
+func truncated(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadAll reads all the transactions of a trace.
+func ReadAll(r io.Reader) ([]Entry, error) {
+	rd, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for {
+		e, err := rd.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Replay is an i2c.Bus serving a trace back to a driver.
+//
+// Transactions must come in the recorded order with the same address and
+// written bytes. The recorded read bytes are returned, and recorded errors
+// are returned as errors with the same message.
+type Replay struct {
+	// Realtime makes Tx wait the recorded time between transactions.
+	Realtime bool
+
+	mu      sync.Mutex
+	entries []Entry
+	count   int
+	last    time.Time
+}
+
+// NewReplay returns a bus replaying entries.
+func NewReplay(entries []Entry) *Replay {
+	return &Replay{entries: entries}
+}
+
+func (p *Replay) String() string {
+	return "replay"
+}
+
+// Tx implements i2c.Bus.
+func (p *Replay) Tx(addr uint16, w, r []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.count >= len(p.entries) {
+		return fmt.Errorf("%w: unexpected transaction %d with 0x%02x, the trace has %d", ErrMismatch, p.count, addr, len(p.entries))
+	}
+	e := p.entries[p.count]
+	if addr != e.Addr || !bytes.Equal(w, e.W) || len(r) != len(e.R) {
+		return fmt.Errorf("%w: transaction %d is 0x%02x W:% x R:%d bytes, trace has %s", ErrMismatch, p.count, addr, w, len(r), e)
+	}
+	if p.Realtime && p.count > 0 {
+		if d := e.Time.Sub(p.entries[p.count-1].Time) - time.Since(p.last); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	p.last = time.Now()
+	p.count++
+	copy(r, e.R)
+	if e.Err != "" {
+		return errors.New(e.Err)
+	}
+	return nil
+}
+
+// SetSpeed implements i2c.Bus.
+func (p *Replay) SetSpeed(f physic.Frequency) error {
+	return nil
+}
+
+// Remaining returns the number of transactions not replayed yet.
+func (p *Replay) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.entries) - p.count
+}
+
+// Close implements i2c.BusCloser, it fails if the trace was not fully replayed.
+func (p *Replay) Close() error {
+	if n := p.Remaining(); n != 0 {
+		return fmt.Errorf("%w: %d transactions not replayed", ErrMismatch, n)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package i2ctrace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"devices/drf0592"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+var (
+	_ i2c.BusCloser = &Recorder{}
+	_ i2c.BusCloser = &Replay{}
+)
+
+func TestRecordReplay(t *testing.T) {
+	bus := i2cemu.NewBus()
+	bus.Attach(drf0592.I2CAddr, sim.NewDFR0592())
+	var buf bytes.Buffer
+	rec, err := NewRecorder(bus, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(b i2c.Bus) drf0592.AngularVelocity {
+		m, err := drf0592.New(b, &drf0592.DefaultOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetEncoderEnable(drf0592.M1)
+		m.SetEncoderReductionRatio(drf0592.M1, 50)
+		m.MotorMovement(drf0592.M1, drf0592.CW, 20)
+		s, err := m.GetEncoderSpeed(drf0592.M1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// no device, the error is recorded
+		if err := b.Tx(0x30, []byte{0}, nil); err == nil {
+			t.Errorf("Tx(0x30) succeeded")
+		}
+		return s
+	}
+	want := run(rec)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := entries[len(entries)-1]
+	if last.Addr != 0x30 || last.Err == "" {
+		t.Errorf("last entry = %s, want an error from 0x30", last)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Time.Before(entries[i-1].Time) {
+			t.Errorf("entry %d goes back in time", i)
+		}
+	}
+
+	p := NewReplay(entries)
+	if got := run(p); got != want {
+		t.Errorf("replayed speed = %s, want %s", got, want)
+	}
+	if err := p.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := p.Tx(0x10, nil, nil); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Tx past the end = %v, want %v", err, ErrMismatch)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	p := NewReplay([]Entry{{Addr: 0x10, W: []byte{1}, R: []byte{0xDF}}})
+	r := make([]byte, 1)
+	if err := p.Tx(0x10, []byte{2}, r); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Tx = %v, want %v", err, ErrMismatch)
+	}
+	if err := p.Close(); err == nil {
+		t.Errorf("Close succeeded with a transaction left")
+	}
+	if err := p.Tx(0x10, []byte{1}, r); err != nil || r[0] != 0xDF {
+		t.Errorf("Tx = %v, %v", r, err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("I2CX\x01\x00"))); err == nil {
+		t.Errorf("bad magic accepted")
+	}
+	var buf bytes.Buffer
+	rec, _ := NewRecorder(&i2cemu.Bus{}, &buf)
+	rec.Tx(0x10, []byte{1, 2, 3}, nil)
+	rec.Close()
+	rd, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rd.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Next() on truncated trace = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
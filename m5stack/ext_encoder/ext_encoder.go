@@ -2,7 +2,9 @@ package ext_encoder
 
 import (
 	"encoding/binary"
-	"fmt"
+
+	"devices/deverr"
+	"devices/m5stack/unit"
 
 	"periph.io/x/conn/v3/i2c"
 )
@@ -46,36 +48,24 @@ var DefaultOpts = Opts{
 
 // Dev is an handle to an M%Stack ExtEncoder units driver.
 type Dev struct {
-	c i2c.Dev
+	*unit.Unit
 }
 
 // New creates a new driver.
 func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
-	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x70 {
-		return nil, fmt.Errorf("invalid device address")
+	if opts.I2cAddress < unit.MIN_ADDR || opts.I2cAddress > unit.MAX_ADDR {
+		return nil, deverr.Paramf("invalid device address")
 	}
 
-	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}
+	dev := &Dev{Unit: unit.New(bus, opts.I2cAddress)}
 	return dev, nil
 }
 
 func (dev *Dev) Close() {
 }
 
-func (h *Dev) readBytes(reg int, size int) ([]uint8, error) {
-	r := make([]byte, size)
-	err := h.c.Tx([]byte{byte(reg)}, r)
-	return r, err
-}
-
-func (h *Dev) writeBytes(reg int, data []uint8) error {
-	d := []byte{byte(reg)}
-	d = append(d, data...)
-	return h.c.Tx(d, nil)
-}
-
 func (h *Dev) GetEncoderValue() (uint32, error) {
-	data, err := h.readBytes(UNIT_EXT_ENCODER_ENCODER_REG, 4)
+	data, err := h.ReadBytes(UNIT_EXT_ENCODER_ENCODER_REG, 4)
 	if err != nil {
 		return 0, err
 	}
@@ -84,7 +74,7 @@ func (h *Dev) GetEncoderValue() (uint32, error) {
 }
 
 func (h *Dev) GetZeroPulseValue() (uint32, error) {
-	data, err := h.readBytes(UNIT_EXT_ENCODER_ZERO_PULSE_VALUE_REG, 4)
+	data, err := h.ReadBytes(UNIT_EXT_ENCODER_ZERO_PULSE_VALUE_REG, 4)
 	if err != nil {
 		return 0, err
 	}
@@ -95,11 +85,11 @@ func (h *Dev) GetZeroPulseValue() (uint32, error) {
 func (h *Dev) SetZeroPulseValue(value uint32) error {
 	data := make([]uint8, 4)
 	binary.LittleEndian.PutUint32(data, value)
-	return h.writeBytes(UNIT_EXT_ENCODER_ZERO_PULSE_VALUE_REG, data)
+	return h.WriteBytes(UNIT_EXT_ENCODER_ZERO_PULSE_VALUE_REG, data)
 }
 
 func (h *Dev) GetMeterValue() (uint32, error) {
-	data, err := h.readBytes(UNIT_EXT_ENCODER_METER_REG, 4)
+	data, err := h.ReadBytes(UNIT_EXT_ENCODER_METER_REG, 4)
 	if err != nil {
 		return 0, err
 	}
@@ -108,7 +98,7 @@ func (h *Dev) GetMeterValue() (uint32, error) {
 }
 
 func (h *Dev) GetMeterString() (string, error) {
-	data, err := h.readBytes(UNIT_EXT_ENCODER_METER_STRING_REG, 9)
+	data, err := h.ReadBytes(UNIT_EXT_ENCODER_METER_STRING_REG, 9)
 	if err != nil {
 		return "", err
 	}
@@ -118,23 +108,23 @@ func (h *Dev) GetMeterString() (string, error) {
 func (h *Dev) ResetEncoder() error {
 	data := make([]uint8, 1)
 	data[0] = 1
-	return h.writeBytes(UNIT_EXT_ENCODER_RESET_REG, data)
+	return h.WriteBytes(UNIT_EXT_ENCODER_RESET_REG, data)
 }
 
 func (h *Dev) SetPerimeter(perimeter uint32) error {
 	data := make([]uint8, 8)
 	binary.LittleEndian.PutUint32(data, perimeter)
-	return h.writeBytes(UNIT_EXT_ENCODER_PERIMETER_REG, data)
+	return h.WriteBytes(UNIT_EXT_ENCODER_PERIMETER_REG, data)
 }
 
 func (h *Dev) SetZeroMode(mode TriggerMode) error {
 	data := make([]uint8, 1)
 	data[0] = uint8(mode)
-	return h.writeBytes(UNIT_EXT_ENCODER_ZERO_MODE_REG, data)
+	return h.WriteBytes(UNIT_EXT_ENCODER_ZERO_MODE_REG, data)
 }
 
 func (h *Dev) GetPerimeter() (uint32, error) {
-	data, err := h.readBytes(UNIT_EXT_ENCODER_PERIMETER_REG, 4)
+	data, err := h.ReadBytes(UNIT_EXT_ENCODER_PERIMETER_REG, 4)
 	if err != nil {
 		return 0, err
 	}
@@ -145,40 +135,14 @@ func (h *Dev) GetPerimeter() (uint32, error) {
 func (h *Dev) SetPulse(pulse uint32) error {
 	data := make([]uint8, 4)
 	binary.LittleEndian.PutUint32(data, pulse)
-	return h.writeBytes(UNIT_EXT_ENCODER_PULSE_REG, data)
+	return h.WriteBytes(UNIT_EXT_ENCODER_PULSE_REG, data)
 }
 
 func (h *Dev) GetPulse() (uint32, error) {
-	data, err := h.readBytes(UNIT_EXT_ENCODER_PULSE_REG, 4)
+	data, err := h.ReadBytes(UNIT_EXT_ENCODER_PULSE_REG, 4)
 	if err != nil {
 		return 0, err
 	}
 	value := binary.LittleEndian.Uint32(data)
 	return value, err
 }
-
-func (h *Dev) SetI2CAddress(addr uint8) error {
-	data := make([]uint8, 1)
-	data[0] = addr
-	err := h.writeBytes(I2C_ADDRESS_REG, data)
-	if err != nil {
-		h.c.Addr = uint16(addr)
-	}
-	return err
-}
-
-func (h *Dev) GetI2CAddress() (uint8, error) {
-	data, err := h.readBytes(I2C_ADDRESS_REG, 1)
-	if err != nil {
-		return 0, err
-	}
-	return data[0], err
-}
-
-func (h *Dev) GetFirmwareVersion() (uint8, error) {
-	data, err := h.readBytes(FIRMWARE_VERSION_REG, 1)
-	if err != nil {
-		return 0, err
-	}
-	return data[0], err
-}
@@ -1,11 +1,20 @@
 package hbridge
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"testing"
 	"time"
 
+	"devices/deverr"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+	"devices/m5stack/unit"
+
 	"periph.io/x/conn/v3/i2c/i2creg"
 	"periph.io/x/host/v3"
 )
@@ -13,13 +22,13 @@ import (
 func TestDev_MotorMovement(t *testing.T) {
 	// Make sure periph is initialized.
 	if _, err := host.Init(); err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 
 	// Use i2creg I²C bus registry to find the first available I²C bus.
 	b, err := i2creg.Open("")
 	if err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 	defer b.Close()
 
@@ -48,3 +57,350 @@ func TestDev_MotorMovement(t *testing.T) {
 	m.Close()
 
 }
+
+func TestDev_emu(t *testing.T) {
+	b := i2cemu.NewBus()
+	rf := i2cemu.NewRegisterFile()
+	rf.Set(HBRIDGE_CONFIG_REG, byte(HBRIDGE_FORWARD))
+	rf.Set(HBRIDGE_FW_VERSION_REG, 1, HBRIDGE_I2C_ADDR)
+	cur := make([]byte, 4)
+	binary.LittleEndian.PutUint32(cur, math.Float32bits(0.75))
+	rf.Set(HBRIDGE_MOTOR_CURRENT_REG, cur...)
+	b.Attach(I2CAddr, rf)
+
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := m.GetDriverDirection(); d != uint8(HBRIDGE_STOP) {
+		t.Errorf("direction after New = %d, want stop", d)
+	}
+	m.SetDriverPWMFreq(1500)
+	if f, err := m.GetDriverPWMFreq(); err != nil || f != 1500 {
+		t.Errorf("GetDriverPWMFreq() = %d, %v", f, err)
+	}
+	m.SetDriverSpeed16Bits(0x1234)
+	if s, err := m.GetDriverSpeed16Bits(); err != nil || s != 0x1234 {
+		t.Errorf("GetDriverSpeed16Bits() = 0x%04x, %v", s, err)
+	}
+	if c, err := m.GetMotorCurrent(); err != nil || c != 0.75 {
+		t.Errorf("GetMotorCurrent() = %f, %v", c, err)
+	}
+	if a, err := m.GetI2CAddress(); err != nil || a != HBRIDGE_I2C_ADDR {
+		t.Errorf("GetI2CAddress() = 0x%02x, %v", a, err)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewHBridge(1)
+	s.Attach(b, I2CAddr)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// samples are taken by the test, the period never elapses
+	opts := DefaultMonitorOpts
+	opts.Period = time.Hour
+	mon, err := NewMonitor(context.Background(), m, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Stop()
+	now := time.Unix(0, 0)
+	sample := func(n int) {
+		for i := 0; i < n; i++ {
+			now = now.Add(20 * time.Millisecond)
+			mon.step(now, 20*time.Millisecond)
+		}
+	}
+
+	// high current while stopped is ignored
+	s.SetCurrent(1.2)
+	sample(20)
+	if st := mon.State(); st.Trips != 0 || st.Current != 1.2 || st.Driven {
+		t.Errorf("stopped motor: %+v", st)
+	}
+
+	// normal load
+	m.SetDriverSpeed16Bits(0x8000)
+	m.SetDriverDirection(HBRIDGE_FORWARD)
+	s.SetCurrent(0.5)
+	sample(20)
+	if st := mon.State(); st.Trips != 0 || !st.Driven {
+		t.Errorf("normal load: %+v", st)
+	}
+
+	// jam: 300ms above the stall current
+	s.SetCurrent(-1.2)
+	sample(14)
+	if st := mon.State(); st.Trips != 0 || st.Stalled != 280*time.Millisecond {
+		t.Fatalf("stopped before the stall time: %+v", st)
+	}
+	sample(1)
+	e := <-mon.Events()
+	if e.Kind != MONITOR_STALL || e.Current != 1.2 || e.Err != nil || !e.Time.Equal(now) {
+		t.Errorf("event = %s", e)
+	}
+	if s.Direction() != byte(HBRIDGE_STOP) || !mon.Tripped() {
+		t.Errorf("motor not stopped after a stall")
+	}
+
+	// the cutoff is latched: the motor is stopped again without a new event
+	m.SetDriverDirection(HBRIDGE_FORWARD)
+	s.SetCurrent(0.5)
+	sample(1)
+	if st := mon.State(); st.Trips != 1 || !st.Tripped || s.Direction() != byte(HBRIDGE_STOP) {
+		t.Errorf("driven while tripped: %+v, direction %d", st, s.Direction())
+	}
+
+	// short circuit
+	mon.Reset()
+	m.SetDriverDirection(HBRIDGE_BACKWARD)
+	s.SetCurrent(2)
+	sample(1)
+	if e := <-mon.Events(); e.Kind != MONITOR_OVERCURRENT || s.Direction() != byte(HBRIDGE_STOP) {
+		t.Errorf("event = %s, direction %d", e, s.Direction())
+	}
+
+	// the bus fails, the error is reported and the motor stopped once it recovers
+	mon.Reset()
+	m.SetDriverDirection(HBRIDGE_FORWARD)
+	s.SetError(errors.New("remote I/O error"))
+	sample(1)
+	if st := mon.State(); !errors.Is(st.Err, deverr.ErrBus) || st.Trips != 2 {
+		t.Errorf("bus failure: %+v", st)
+	}
+	s.SetError(nil)
+	sample(1)
+	if st := mon.State(); st.Err != nil || st.Trips != 3 || st.LastTrip.Kind != MONITOR_OVERCURRENT {
+		t.Errorf("after the bus recovered: %+v", st)
+	}
+
+	if _, err := NewMonitor(context.Background(), m, &MonitorOpts{}); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("NewMonitor() with zero options = %v", err)
+	}
+	opts.MaxCurrent = opts.StallCurrent
+	if _, err := NewMonitor(context.Background(), m, &opts); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("NewMonitor() with MaxCurrent at StallCurrent = %v", err)
+	}
+}
+
+func TestDev_SetVelocity(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewHBridge(1)
+	s.Attach(b, I2CAddr)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []int32{MAX_VELOCITY, -0x1234, 0} {
+		if err := m.SetVelocity(v); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := m.GetVelocity(); err != nil || got != v {
+			t.Errorf("GetVelocity() = %d, %v, want %d", got, err, v)
+		}
+	}
+	m.SetVelocity(-0x1234)
+	if s.Direction() != byte(HBRIDGE_BACKWARD) || s.Speed() != 0x1234 {
+		t.Errorf("direction %d speed 0x%04x", s.Direction(), s.Speed())
+	}
+	if sp, _ := m.GetDriverSpeed8Bits(); sp != 0x12 {
+		t.Errorf("8 bit speed = 0x%02x, want 0x12", sp)
+	}
+	if err := m.SetVelocity(MAX_VELOCITY + 1); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("SetVelocity(0x10000) = %v", err)
+	}
+}
+
+func TestRamp(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewHBridge(1)
+	s.Attach(b, I2CAddr)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// steps are run by the test, the period never elapses
+	opts := RampOpts{Period: time.Hour, Accel: 1000, Decel: 2000, ReverseDwell: 100 * time.Millisecond}
+	r, err := NewRamp(context.Background(), m, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(n int) {
+		for i := 0; i < n; i++ {
+			r.step(10 * time.Millisecond)
+		}
+	}
+	velocity := func() int32 {
+		v, err := m.GetVelocity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// 10 per step up to 500
+	r.SetTarget(500)
+	run(10)
+	if v := velocity(); v != 100 {
+		t.Errorf("velocity after 100ms = %d, want 100", v)
+	}
+	run(50)
+	if v := velocity(); v != 500 {
+		t.Errorf("velocity after 600ms = %d, want 500", v)
+	}
+
+	// reversal: 20 per step down to 0, dwell, then 10 per step
+	r.SetTarget(-200)
+	run(25)
+	if v, st := velocity(), r.State(); v != 0 || !st.Dwell || s.Direction() != byte(HBRIDGE_STOP) {
+		t.Errorf("velocity after deceleration = %d, %+v", v, st)
+	}
+	run(9)
+	if v := velocity(); v != 0 {
+		t.Errorf("velocity during the dwell = %d, want 0", v)
+	}
+	run(1)
+	if v := velocity(); v != -10 {
+		t.Errorf("velocity after the dwell = %d, want -10", v)
+	}
+	run(20)
+	if st := r.State(); st.Velocity != -200 || st.Target != -200 || st.Err != nil {
+		t.Errorf("state = %+v", st)
+	}
+
+	// a failed step is retried
+	s.SetError(errors.New("remote I/O error"))
+	r.SetTarget(-180)
+	run(1)
+	if st := r.State(); !errors.Is(st.Err, deverr.ErrBus) || st.Velocity != -200 {
+		t.Errorf("state on a failing bus = %+v", st)
+	}
+	s.SetError(nil)
+	run(1)
+	if st := r.State(); st.Err != nil || st.Velocity != -180 {
+		t.Errorf("state after the bus recovered = %+v", st)
+	}
+
+	if err := r.Stop(); err != nil || velocity() != 0 {
+		t.Errorf("Stop() = %v, velocity %d", err, velocity())
+	}
+}
+
+func TestRamp_monitor(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewHBridge(1)
+	s.Attach(b, I2CAddr)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// steps and samples are run by the test, the periods never elapse
+	mopts := DefaultMonitorOpts
+	mopts.Period = time.Hour
+	mon, err := NewMonitor(context.Background(), m, &mopts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mon.Stop()
+	opts := RampOpts{Period: time.Hour, Accel: 1000, Decel: 2000, Monitor: mon}
+	r, err := NewRamp(context.Background(), m, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// jammed while accelerating
+	r.SetTarget(500)
+	for i := 0; i < 5; i++ {
+		r.step(10 * time.Millisecond)
+	}
+	s.SetCurrent(2)
+	mon.step(time.Unix(0, 0), 20*time.Millisecond)
+	if !mon.Tripped() || s.Direction() != byte(HBRIDGE_STOP) {
+		t.Fatalf("monitor did not trip")
+	}
+	for i := 0; i < 10; i++ {
+		r.step(10 * time.Millisecond)
+	}
+	if st := r.State(); !st.Halted || st.Velocity != 0 || st.Target != 0 || s.Direction() != byte(HBRIDGE_STOP) {
+		t.Errorf("ramp after the trip = %+v, direction %d", st, s.Direction())
+	}
+
+	// a new target waits for the reset
+	r.SetTarget(300)
+	r.step(10 * time.Millisecond)
+	if s.Direction() != byte(HBRIDGE_STOP) {
+		t.Errorf("ramp drove the motor while tripped")
+	}
+	mon.Reset()
+	s.SetCurrent(0.5)
+	r.step(10 * time.Millisecond)
+	if st := r.State(); st.Halted || st.Velocity != 10 {
+		t.Errorf("ramp after the reset = %+v", st)
+	}
+}
+
+func TestDev_SetI2CAddress(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewHBridge(2)
+	s.Attach(b, I2CAddr)
+	other := sim.NewHBridge(2)
+	other.Attach(b, 0x22)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetI2CAddress(0x22); !errors.Is(err, deverr.ErrParameter) || s.Addr() != I2CAddr {
+		t.Errorf("SetI2CAddress() to a used address = %v", err)
+	}
+	if err := m.SetI2CAddress(0x78); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("SetI2CAddress(0x78) = %v", err)
+	}
+	if err := m.SetI2CAddress(0x21); err != nil {
+		t.Fatal(err)
+	}
+	if s.Addr() != 0x21 {
+		t.Errorf("unit at 0x%02x, want 0x21", s.Addr())
+	}
+	if a, err := m.GetI2CAddress(); err != nil || a != 0x21 {
+		t.Errorf("GetI2CAddress() = 0x%02x, %v", a, err)
+	}
+	m.SetVelocity(100)
+	if s.Speed() != 100 || other.Speed() != 0 {
+		t.Errorf("the Dev does not drive the moved unit")
+	}
+
+	// the unit ignores the write
+	ProbeTimeout = 0
+	defer func() { ProbeTimeout = 500 * time.Millisecond }()
+	s.OnWrite(HBRIDGE_I2C_ADDRESS_REG, func(*i2cemu.RegisterFile, byte, byte) {})
+	if err := m.SetI2CAddress(0x23); !errors.Is(err, deverr.ErrNotDetected) {
+		t.Errorf("SetI2CAddress() ignored by the unit = %v", err)
+	}
+	if a, err := m.GetI2CAddress(); err != nil || a != 0x21 {
+		t.Errorf("GetI2CAddress() after a failed move = 0x%02x, %v", a, err)
+	}
+}
+
+func TestNew_addressRange(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewHBridge(2)
+	s.Attach(b, I2CAddr)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a unit moved to the last address can be opened again
+	if err := m.SetI2CAddress(unit.MAX_ADDR); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(b, &Opts{I2cAddress: unit.MAX_ADDR}); err != nil {
+		t.Errorf("New() at 0x%02x = %v", unit.MAX_ADDR, err)
+	}
+	if _, err := New(b, &Opts{I2cAddress: unit.MAX_ADDR + 1}); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("New() at 0x%02x = %v", unit.MAX_ADDR+1, err)
+	}
+}
@@ -3,7 +3,10 @@ package hbridge
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
+	"time"
+
+	"devices/deverr"
+	"devices/m5stack/unit"
 
 	"periph.io/x/conn/v3/i2c"
 )
@@ -49,19 +52,24 @@ var DefaultOpts = Opts{
 	PwmFreq:    1500,
 }
 
+// ProbeTimeout is how long SetI2CAddress waits for the unit at its new address.
+var ProbeTimeout = 500 * time.Millisecond
+
 // Dev is an handle to an M5Stack HBrige Motors driver.
 type Dev struct {
-	c i2c.Dev
+	*unit.Unit
 }
 
 // New creates a new driver for M5Stack HBrige motor driver.
 func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
-	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x70 {
-		return nil, fmt.Errorf("invalid device address")
+	if opts.I2cAddress < unit.MIN_ADDR || opts.I2cAddress > unit.MAX_ADDR {
+		return nil, deverr.Paramf("invalid device address")
 	}
 
-	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}
-	dev.SetDriverDirection(HBRIDGE_STOP)
+	dev := &Dev{Unit: unit.New(bus, opts.I2cAddress)}
+	if err := dev.SetDriverDirection(HBRIDGE_STOP); err != nil {
+		return nil, err
+	}
 
 	return dev, nil
 }
@@ -72,20 +80,8 @@ func (dev *Dev) Close() {
 	}
 }
 
-func (h *Dev) readBytes(reg int, size int) ([]uint8, error) {
-	r := make([]byte, size)
-	err := h.c.Tx([]byte{byte(reg)}, r)
-	return r, err
-}
-
-func (h *Dev) writeBytes(reg int, data []uint8) error {
-	d := []byte{byte(reg)}
-	d = append(d, data...)
-	return h.c.Tx(d, nil)
-}
-
 func (h *Dev) GetDriverDirection() (uint8, error) {
-	data, err := h.readBytes(HBRIDGE_CONFIG_REG, 1)
+	data, err := h.ReadBytes(HBRIDGE_CONFIG_REG, 1)
 	if err != nil {
 		return 0, err
 	}
@@ -93,7 +89,7 @@ func (h *Dev) GetDriverDirection() (uint8, error) {
 }
 
 func (h *Dev) GetDriverSpeed8Bits() (uint8, error) {
-	data, err := h.readBytes(HBRIDGE_CONFIG_REG+1, 1)
+	data, err := h.ReadBytes(HBRIDGE_CONFIG_REG+1, 1)
 	if err != nil {
 		return 0, err
 	}
@@ -101,7 +97,7 @@ func (h *Dev) GetDriverSpeed8Bits() (uint8, error) {
 }
 
 func (h *Dev) GetDriverSpeed16Bits() (uint16, error) {
-	data, err := h.readBytes(HBRIDGE_CONFIG_REG+2, 2)
+	data, err := h.ReadBytes(HBRIDGE_CONFIG_REG+2, 2)
 	if err != nil {
 		return 0, err
 	}
@@ -109,7 +105,7 @@ func (h *Dev) GetDriverSpeed16Bits() (uint16, error) {
 }
 
 func (h *Dev) GetDriverPWMFreq() (uint16, error) {
-	data, err := h.readBytes(HBRIDGE_CONFIG_REG+4, 2)
+	data, err := h.ReadBytes(HBRIDGE_CONFIG_REG+4, 2)
 	if err != nil {
 		return 0, err
 	}
@@ -118,33 +114,69 @@ func (h *Dev) GetDriverPWMFreq() (uint16, error) {
 
 func (h *Dev) SetDriverPWMFreq(freq uint16) error {
 	data := []uint8{uint8(freq & 0xff), uint8((freq >> 8) & 0xff)}
-	return h.writeBytes(HBRIDGE_CONFIG_REG+4, data)
+	return h.WriteBytes(HBRIDGE_CONFIG_REG+4, data)
 }
 
 func (h *Dev) SetDriverDirection(dir HbridgeDirection) error {
 	data := []uint8{uint8(dir)}
-	return h.writeBytes(HBRIDGE_CONFIG_REG, data)
+	return h.WriteBytes(HBRIDGE_CONFIG_REG, data)
 }
 
 func (h *Dev) SetDriverSpeed8Bits(speed uint8) error {
 	data := []uint8{speed}
-	return h.writeBytes(HBRIDGE_CONFIG_REG+1, data)
+	return h.WriteBytes(HBRIDGE_CONFIG_REG+1, data)
 }
 
 func (h *Dev) SetDriverSpeed16Bits(speed uint16) error {
 	data := []uint8{uint8(speed), uint8(speed >> 8)}
-	return h.writeBytes(HBRIDGE_CONFIG_REG+2, data)
+	return h.WriteBytes(HBRIDGE_CONFIG_REG+2, data)
+}
+
+// MAX_VELOCITY is the full speed of SetVelocity, the 16 bit speed register.
+const MAX_VELOCITY = 0xFFFF
+
+// SetVelocity sets the direction and the 16 bit speed in one transaction,
+// from -MAX_VELOCITY (backward) to MAX_VELOCITY (forward), 0 stops the motor.
+// Use a Ramp to reverse a loaded motor.
+func (h *Dev) SetVelocity(velocity int32) error {
+	if velocity < -MAX_VELOCITY || velocity > MAX_VELOCITY {
+		return deverr.Paramf("velocity out of range: -%d-%d", MAX_VELOCITY, MAX_VELOCITY)
+	}
+	dir, speed := HBRIDGE_FORWARD, uint16(velocity)
+	if velocity < 0 {
+		dir, speed = HBRIDGE_BACKWARD, uint16(-velocity)
+	} else if velocity == 0 {
+		dir = HBRIDGE_STOP
+	}
+	// direction, 8 bit speed then 16 bit speed
+	return h.WriteBytes(HBRIDGE_CONFIG_REG, []uint8{uint8(dir), uint8(speed >> 8), uint8(speed), uint8(speed >> 8)})
+}
+
+// GetVelocity returns the signed velocity set on the unit, see SetVelocity.
+func (h *Dev) GetVelocity() (int32, error) {
+	data, err := h.ReadBytes(HBRIDGE_CONFIG_REG, 4)
+	if err != nil {
+		return 0, err
+	}
+	speed := int32(binary.LittleEndian.Uint16(data[2:]))
+	switch HbridgeDirection(data[0]) {
+	case HBRIDGE_FORWARD:
+		return speed, nil
+	case HBRIDGE_BACKWARD:
+		return -speed, nil
+	}
+	return 0, nil
 }
 
 func (h *Dev) GetAnalogInput(bit HbridgeAnalogReadMode) (uint16, error) {
 	if bit == _8bit {
-		data, err := h.readBytes(HBRIDGE_MOTOR_ADC_8BIT_REG, 1)
+		data, err := h.ReadBytes(HBRIDGE_MOTOR_ADC_8BIT_REG, 1)
 		if err != nil {
 			return 0, err
 		}
 		return uint16(data[0]), err
 	} else {
-		data, err := h.readBytes(HBRIDGE_MOTOR_ADC_12BIT_REG, 2)
+		data, err := h.ReadBytes(HBRIDGE_MOTOR_ADC_12BIT_REG, 2)
 		if err != nil {
 			return 0, err
 		}
@@ -153,7 +185,7 @@ func (h *Dev) GetAnalogInput(bit HbridgeAnalogReadMode) (uint16, error) {
 }
 
 func (h *Dev) GetMotorCurrent() (float32, error) {
-	data, err := h.readBytes(HBRIDGE_MOTOR_CURRENT_REG, 4)
+	data, err := h.ReadBytes(HBRIDGE_MOTOR_CURRENT_REG, 4)
 	if err != nil {
 		return 0, err
 	}
@@ -162,23 +194,8 @@ func (h *Dev) GetMotorCurrent() (float32, error) {
 	return c, err
 }
 
-func (h *Dev) GetFirmwareVersion() (uint8, error) {
-	data, err := h.readBytes(HBRIDGE_FW_VERSION_REG, 1)
-	if err != nil {
-		return 0, err
-	}
-	return data[0], err
-}
-
-func (h *Dev) GetI2CAddress() (uint8, error) {
-	data, err := h.readBytes(HBRIDGE_I2C_ADDRESS_REG, 1)
-	if err != nil {
-		return 0, err
-	}
-	return data[0], err
-}
-
-func (h *Dev) JumpBootloader() error {
-	value := uint8(1)
-	return h.writeBytes(HBRIDGE_JUMP_TO_BOOTLOADER_REG, []uint8{value})
+// SetI2CAddress moves the unit to addr, see unit.Unit.SetI2CAddress, waiting up
+// to ProbeTimeout for the unit at its new address.
+func (h *Dev) SetI2CAddress(addr uint8) error {
+	return h.Unit.SetI2CAddressTimeout(addr, ProbeTimeout)
 }
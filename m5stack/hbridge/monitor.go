@@ -0,0 +1,226 @@
+package hbridge
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"devices/deverr"
+)
+
+// MonitorOpts holds the current monitor options.
+type MonitorOpts struct {
+	Period       time.Duration // sampling period
+	StallCurrent float32       // A, current of a stalled motor
+	StallTime    time.Duration // time above StallCurrent while driven before the motor is stopped
+	MaxCurrent   float32       // A, more than StallCurrent, the motor is stopped at once above it
+}
+
+// DefaultMonitorOpts are conservative limits, to be set for each motor from
+// its stall current.
+var DefaultMonitorOpts = MonitorOpts{
+	Period:       20 * time.Millisecond,
+	StallCurrent: 1.0,
+	StallTime:    300 * time.Millisecond,
+	MaxCurrent:   1.5,
+}
+
+// EventKind is the reason the monitor stopped the motor.
+type EventKind int
+
+const (
+	MONITOR_STALL EventKind = iota
+	MONITOR_OVERCURRENT
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case MONITOR_STALL:
+		return "stall"
+	case MONITOR_OVERCURRENT:
+		return "overcurrent"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event reports that the monitor stopped the motor.
+type Event struct {
+	Kind    EventKind
+	Current float32 // A
+	Time    time.Time
+	Err     error // error of the stop command, the monitor retries on the next sample
+}
+
+func (e Event) String() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s at %.3fA, stop failed: %v", e.Kind, e.Current, e.Err)
+	}
+	return fmt.Sprintf("%s at %.3fA, motor stopped", e.Kind, e.Current)
+}
+
+// MonitorState is the last sample of the monitor.
+type MonitorState struct {
+	Current  float32       // A
+	Driven   bool          // direction set and non-zero speed
+	Stalled  time.Duration // time spent above StallCurrent while driven
+	Trips    int           // number of events
+	Tripped  bool          // the cutoff holds until Reset
+	Err      error         // last bus error
+	LastTrip *Event
+}
+
+// Monitor samples the motor current and stops the motor when it stalls or
+// draws more than MaxCurrent while driven. The direction and speed are read
+// from the unit, so commands from any source are covered.
+//
+// The cutoff is latched: until Reset is called, the motor is stopped again at
+// the next sample whenever it is driven, without a new event.
+type Monitor struct {
+	dev    *Dev
+	opts   MonitorOpts
+	events chan Event
+
+	mu     sync.Mutex
+	state  MonitorState
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMonitor starts monitoring dev until ctx is done or Stop is called.
+func NewMonitor(ctx context.Context, dev *Dev, opts *MonitorOpts) (*Monitor, error) {
+	if opts.Period <= 0 {
+		return nil, deverr.Paramf("invalid sampling period %s", opts.Period)
+	}
+	if opts.StallCurrent <= 0 || opts.MaxCurrent <= 0 || opts.StallTime < 0 {
+		return nil, deverr.Paramf("invalid current limits")
+	}
+	// the overcurrent cutoff would always trip before the stall detection
+	if opts.MaxCurrent <= opts.StallCurrent {
+		return nil, deverr.Paramf("max current %gA not above stall current %gA", opts.MaxCurrent, opts.StallCurrent)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	m := &Monitor{
+		dev:    dev,
+		opts:   *opts,
+		events: make(chan Event, 8),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go m.run(ctx)
+	return m, nil
+}
+
+// Events returns the events, it is closed when the monitor stops. Events are
+// dropped when it is not read, State keeps the last one.
+func (m *Monitor) Events() <-chan Event {
+	return m.events
+}
+
+// State returns the last sample.
+func (m *Monitor) State() MonitorState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Tripped reports whether the cutoff is latched.
+func (m *Monitor) Tripped() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state.Tripped
+}
+
+// Reset clears the latched cutoff, the motor can be driven again.
+func (m *Monitor) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Tripped = false
+	m.state.Stalled = 0
+}
+
+// Stop ends the monitoring, the motor is left as is.
+func (m *Monitor) Stop() {
+	m.cancel()
+	<-m.done
+}
+
+func (m *Monitor) run(ctx context.Context) {
+	defer close(m.done)
+	defer close(m.events)
+	ticker := time.NewTicker(m.opts.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.step(now, m.opts.Period)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// step takes one sample at now, dt after the previous one.
+func (m *Monitor) step(now time.Time, dt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &m.state
+	config, err := m.dev.ReadBytes(HBRIDGE_CONFIG_REG, 4)
+	if err != nil {
+		s.Err = err
+		return
+	}
+	current, err := m.dev.GetMotorCurrent()
+	if err != nil {
+		s.Err = err
+		return
+	}
+	s.Err = nil
+	if current < 0 {
+		current = -current
+	}
+	s.Current = current
+	s.Driven = HbridgeDirection(config[0]) != HBRIDGE_STOP && binary.LittleEndian.Uint16(config[2:]) != 0
+
+	if s.Tripped {
+		if s.Driven {
+			if err := m.dev.SetDriverDirection(HBRIDGE_STOP); err != nil {
+				s.Err = err
+			} else {
+				s.Driven = false
+			}
+		}
+		return
+	}
+	if s.Driven && current >= m.opts.StallCurrent {
+		s.Stalled += dt
+	} else {
+		s.Stalled = 0
+	}
+	// a stopped motor cannot be cut off, it would trip on every sample
+	switch {
+	case !s.Driven:
+	case current >= m.opts.MaxCurrent:
+		m.trip(now, MONITOR_OVERCURRENT)
+	case s.Stalled > 0 && s.Stalled >= m.opts.StallTime:
+		m.trip(now, MONITOR_STALL)
+	}
+}
+
+func (m *Monitor) trip(now time.Time, kind EventKind) {
+	s := &m.state
+	e := Event{Kind: kind, Current: s.Current, Time: now}
+	e.Err = m.dev.SetDriverDirection(HBRIDGE_STOP)
+	if e.Err == nil {
+		s.Driven = false
+	}
+	s.Stalled = 0
+	s.Tripped = true
+	s.Trips++
+	s.LastTrip = &e
+	select {
+	case m.events <- e:
+	default:
+	}
+}
@@ -0,0 +1,184 @@
+package hbridge
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"devices/deverr"
+)
+
+// RampOpts holds the ramp generator options, rates are in velocity units
+// (MAX_VELOCITY is full speed) per second.
+type RampOpts struct {
+	Period       time.Duration // update period
+	Accel        float64       // rate when the speed increases
+	Decel        float64       // rate when the speed decreases
+	ReverseDwell time.Duration // time stopped before a change of direction
+	Monitor      *Monitor      // optional, the ramp stops while its cutoff is latched
+}
+
+// DefaultRampOpts reach full speed in 1s, stop in 0.5s and wait 200ms before
+// reversing.
+var DefaultRampOpts = RampOpts{
+	Period:       20 * time.Millisecond,
+	Accel:        MAX_VELOCITY,
+	Decel:        2 * MAX_VELOCITY,
+	ReverseDwell: 200 * time.Millisecond,
+}
+
+// RampState is the state of the ramp generator.
+type RampState struct {
+	Target   int32
+	Velocity int32 // last velocity set on the unit
+	Dwell    bool  // stopped before a change of direction
+	Halted   bool  // stopped by the monitor, waiting for Monitor.Reset
+	Err      error // last bus error
+}
+
+// Ramp moves the velocity of the unit to a target at limited rates. A change
+// of direction decelerates to zero, waits ReverseDwell, then accelerates.
+//
+// When the monitor of RampOpts trips, the ramp takes the motor as stopped,
+// sets its target to zero and writes nothing until the monitor is reset.
+type Ramp struct {
+	dev  *Dev
+	opts RampOpts
+
+	mu       sync.Mutex
+	target   float64
+	velocity float64
+	dwell    time.Duration
+	halted   bool
+	err      error
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewRamp starts the ramp generator from the velocity set on the unit, until
+// ctx is done or Stop is called.
+func NewRamp(ctx context.Context, dev *Dev, opts *RampOpts) (*Ramp, error) {
+	if opts.Period <= 0 {
+		return nil, deverr.Paramf("invalid ramp period %s", opts.Period)
+	}
+	if opts.Accel <= 0 || opts.Decel <= 0 || opts.ReverseDwell < 0 {
+		return nil, deverr.Paramf("invalid ramp rates")
+	}
+	v, err := dev.GetVelocity()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Ramp{
+		dev:      dev,
+		opts:     *opts,
+		target:   float64(v),
+		velocity: float64(v),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r, nil
+}
+
+// SetTarget sets the velocity to reach, see SetVelocity.
+func (r *Ramp) SetTarget(velocity int32) error {
+	if velocity < -MAX_VELOCITY || velocity > MAX_VELOCITY {
+		return deverr.Paramf("velocity out of range: -%d-%d", MAX_VELOCITY, MAX_VELOCITY)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.target = float64(velocity)
+	return nil
+}
+
+// State returns the state of the ramp.
+func (r *Ramp) State() RampState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RampState{
+		Target:   int32(r.target),
+		Velocity: int32(math.Round(r.velocity)),
+		Dwell:    r.dwell > 0,
+		Halted:   r.halted,
+		Err:      r.err,
+	}
+}
+
+// Stop ends the ramp generator and stops the motor at once.
+func (r *Ramp) Stop() error {
+	r.cancel()
+	<-r.done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dev.SetVelocity(0)
+}
+
+func (r *Ramp) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(r.opts.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.step(r.opts.Period)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// step moves the velocity dt after the previous step.
+func (r *Ramp) step(dt time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.opts.Monitor != nil && r.opts.Monitor.Tripped() {
+		if !r.halted {
+			r.halted, r.target = true, 0
+		}
+		r.velocity, r.dwell, r.err = 0, 0, nil
+		return
+	}
+	r.halted = false
+	if r.dwell > 0 {
+		r.dwell -= dt
+		if r.dwell > 0 {
+			return
+		}
+		r.dwell = 0
+	}
+	v, target := r.velocity, r.target
+	if v == target && r.err == nil {
+		return
+	}
+	dwell := time.Duration(0)
+	switch {
+	case v > 0 && target <= 0 || v < 0 && target >= 0:
+		// decelerate to zero first
+		v = toward(v, 0, r.opts.Decel*dt.Seconds())
+		if v == 0 && target != 0 {
+			dwell = r.opts.ReverseDwell
+		}
+	case math.Abs(target) > math.Abs(v):
+		v = toward(v, target, r.opts.Accel*dt.Seconds())
+	default:
+		v = toward(v, target, r.opts.Decel*dt.Seconds())
+	}
+	// the velocity only moves once it is set, a failed step is retried
+	if r.err = r.dev.SetVelocity(int32(math.Round(v))); r.err != nil {
+		return
+	}
+	r.velocity, r.dwell = v, dwell
+}
+
+// toward moves v to target by at most step.
+func toward(v, target, step float64) float64 {
+	if math.Abs(target-v) <= step {
+		return target
+	}
+	if target > v {
+		return v + step
+	}
+	return v - step
+}
@@ -1,8 +1,8 @@
 // Use of this source code is governed under the Apache License, Version 2.0
 // that can be found in the LICENSE file.
 
-// Package drf0592 controls DC Motor Driver HAT(V1.0) for Raspberry Pi via
-// I²C interface.
+// Package rfid2_unit controls M5Stack RFID 2 unit (WS1850S, MFRC522 compatible)
+// ISO/IEC 14443 type A reader via I²C interface.
 //
 // Product page: https://shop.m5stack.com/products/rfid-unit-2-ws1850s
 // Source code:  https://github.com/m5stack/M5Stack/tree/master/examples/Unit/RFID_RC522
@@ -0,0 +1,377 @@
+package rfid2_unit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"devices/deverr"
+)
+
+// MIFARE Classic commands
+const (
+	PICC_CMD_MF_AUTH_KEY_A = 0x60
+	PICC_CMD_MF_AUTH_KEY_B = 0x61
+	PICC_CMD_MF_READ       = 0x30
+	PICC_CMD_MF_WRITE      = 0xA0
+	PICC_CMD_MF_DECREMENT  = 0xC0
+	PICC_CMD_MF_INCREMENT  = 0xC1
+	PICC_CMD_MF_RESTORE    = 0xC2
+	PICC_CMD_MF_TRANSFER   = 0xB0
+
+	MF_ACK        = 0x0A // 4 bits acknowledge
+	MF_BLOCK_SIZE = 16
+
+	STATUS2_MF_CRYPTO1_ON = 0x08
+)
+
+// PiccType is the card type as reported by SAK.
+type PiccType int
+
+const (
+	PICC_TYPE_UNKNOWN PiccType = iota
+	PICC_TYPE_ISO_14443_4
+	PICC_TYPE_ISO_18092
+	PICC_TYPE_MIFARE_MINI
+	PICC_TYPE_MIFARE_1K
+	PICC_TYPE_MIFARE_4K
+	PICC_TYPE_MIFARE_UL
+	PICC_TYPE_MIFARE_PLUS
+	PICC_TYPE_NOT_COMPLETE
+)
+
+// KeyType selects the key used for authentication.
+type KeyType byte
+
+const (
+	KEY_A KeyType = PICC_CMD_MF_AUTH_KEY_A
+	KEY_B KeyType = PICC_CMD_MF_AUTH_KEY_B
+)
+
+// Key is a MIFARE Classic Crypto1 key.
+type Key [6]byte
+
+// DefaultKey is the factory default key A and B.
+var DefaultKey = Key{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+var (
+	ErrNAK      = errors.New("PICC did not acknowledge")
+	ErrAuth     = errors.New("authentication failed")
+	ErrBadValue = errors.New("not a value block")
+	ErrBadTrail = errors.New("inconsistent access bits")
+)
+
+// GetPiccType decodes SAK, see NXP AN10833.
+func GetPiccType(sak uint8) PiccType {
+	switch sak & 0x7F {
+	case 0x04:
+		return PICC_TYPE_NOT_COMPLETE
+	case 0x09:
+		return PICC_TYPE_MIFARE_MINI
+	case 0x08:
+		return PICC_TYPE_MIFARE_1K
+	case 0x18:
+		return PICC_TYPE_MIFARE_4K
+	case 0x00:
+		return PICC_TYPE_MIFARE_UL
+	case 0x10, 0x11:
+		return PICC_TYPE_MIFARE_PLUS
+	case 0x20:
+		return PICC_TYPE_ISO_14443_4
+	case 0x40:
+		return PICC_TYPE_ISO_18092
+	}
+	return PICC_TYPE_UNKNOWN
+}
+
+// Type returns the card type.
+func (c *Card) Type() PiccType {
+	return GetPiccType(c.SAK)
+}
+
+// Authenticate enables Crypto1 for the sector of block using the key and the card UID.
+// Call StopCrypto1 when done with the card.
+func (h *Dev) Authenticate(keyType KeyType, block uint8, key Key, uid []byte) error {
+	if len(uid) < 4 {
+		return deverr.Paramf("wrong UID length")
+	}
+	// Use the last 4 UID bytes, NXP AN10927 section 3.2.5
+	data := []byte{byte(keyType), block}
+	data = append(data, key[:]...)
+	data = append(data, uid[len(uid)-4:]...)
+	if _, _, err := h.communicate(PCD_MF_AUTHENT, 0x10, data, 0, 0); err != nil {
+		if errors.Is(err, ErrTimeout) {
+			return ErrAuth
+		}
+		return err
+	}
+	s, err := h.readReg(STATUS2_REG)
+	if err != nil {
+		return err
+	}
+	if s&STATUS2_MF_CRYPTO1_ON == 0 {
+		return ErrAuth
+	}
+	return nil
+}
+
+// StopCrypto1 leaves the authenticated state, it must be called before
+// communicating with another card.
+func (h *Dev) StopCrypto1() error {
+	return h.clearBits(STATUS2_REG, STATUS2_MF_CRYPTO1_ON)
+}
+
+// mifareTransceive sends data with CRC_A and expects the 4 bits MIFARE ACK.
+// If acceptTimeout is set a missing answer is a success.
+func (h *Dev) mifareTransceive(data []byte, acceptTimeout bool) error {
+	back, bits, err := h.transceive(appendCRC(append([]byte{}, data...)), 0, false)
+	if err != nil {
+		if acceptTimeout && errors.Is(err, ErrTimeout) {
+			return nil
+		}
+		return err
+	}
+	if len(back) != 1 || bits != 4 {
+		return fmt.Errorf("%w: unexpected answer % x", ErrProtocol, back)
+	}
+	if back[0]&0x0F != MF_ACK {
+		return fmt.Errorf("%w: 0x%x", ErrNAK, back[0]&0x0F)
+	}
+	return nil
+}
+
+// ReadBlock reads the 16 bytes of an authenticated block.
+func (h *Dev) ReadBlock(block uint8) ([]byte, error) {
+	back, bits, err := h.transceive(appendCRC([]byte{PICC_CMD_MF_READ, block}), 0, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(back) == 1 && bits == 4 {
+		return nil, fmt.Errorf("%w: 0x%x", ErrNAK, back[0]&0x0F)
+	}
+	if back, err = stripCRC(back); err != nil {
+		return nil, err
+	}
+	if len(back) != MF_BLOCK_SIZE {
+		return nil, fmt.Errorf("%w: read %d bytes", ErrProtocol, len(back))
+	}
+	return back, nil
+}
+
+// WriteBlock writes the 16 bytes of an authenticated block.
+func (h *Dev) WriteBlock(block uint8, data []byte) error {
+	if len(data) != MF_BLOCK_SIZE {
+		return deverr.Paramf("block data must be %d bytes", MF_BLOCK_SIZE)
+	}
+	if err := h.mifareTransceive([]byte{PICC_CMD_MF_WRITE, block}, false); err != nil {
+		return err
+	}
+	return h.mifareTransceive(data, false)
+}
+
+func (h *Dev) valueOperation(cmd uint8, block uint8, delta int32) error {
+	if err := h.mifareTransceive([]byte{cmd, block}, false); err != nil {
+		return err
+	}
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(delta))
+	// The PICC does not acknowledge the second step.
+	return h.mifareTransceive(data, true)
+}
+
+// Increment adds delta to the value block and keeps the result in the internal register.
+// Use Transfer to store it.
+func (h *Dev) Increment(block uint8, delta int32) error {
+	return h.valueOperation(PICC_CMD_MF_INCREMENT, block, delta)
+}
+
+// Decrement subtracts delta from the value block and keeps the result in the internal register.
+// Use Transfer to store it.
+func (h *Dev) Decrement(block uint8, delta int32) error {
+	return h.valueOperation(PICC_CMD_MF_DECREMENT, block, delta)
+}
+
+// Restore copies the value block into the internal register.
+func (h *Dev) Restore(block uint8) error {
+	return h.valueOperation(PICC_CMD_MF_RESTORE, block, 0)
+}
+
+// Transfer writes the internal register into the value block.
+func (h *Dev) Transfer(block uint8) error {
+	return h.mifareTransceive([]byte{PICC_CMD_MF_TRANSFER, block}, false)
+}
+
+// ReadValue reads a value block.
+func (h *Dev) ReadValue(block uint8) (int32, error) {
+	data, err := h.ReadBlock(block)
+	if err != nil {
+		return 0, err
+	}
+	v, _, err := DecodeValueBlock(data)
+	return v, err
+}
+
+// WriteValue formats block as a value block holding value.
+func (h *Dev) WriteValue(block uint8, value int32) error {
+	data := EncodeValueBlock(value, block)
+	return h.WriteBlock(block, data[:])
+}
+
+// EncodeValueBlock builds a value block: value, ~value, value, addr, ~addr, addr, ~addr.
+func EncodeValueBlock(value int32, addr uint8) [MF_BLOCK_SIZE]byte {
+	var b [MF_BLOCK_SIZE]byte
+	v := uint32(value)
+	binary.LittleEndian.PutUint32(b[0:], v)
+	binary.LittleEndian.PutUint32(b[4:], ^v)
+	binary.LittleEndian.PutUint32(b[8:], v)
+	b[12], b[13], b[14], b[15] = addr, ^addr, addr, ^addr
+	return b
+}
+
+// DecodeValueBlock checks the value block redundancy and returns value and address.
+func DecodeValueBlock(data []byte) (int32, uint8, error) {
+	if len(data) != MF_BLOCK_SIZE {
+		return 0, 0, ErrBadValue
+	}
+	v := binary.LittleEndian.Uint32(data[0:])
+	if binary.LittleEndian.Uint32(data[4:]) != ^v || binary.LittleEndian.Uint32(data[8:]) != v {
+		return 0, 0, ErrBadValue
+	}
+	a := data[12]
+	if data[13] != ^a || data[14] != a || data[15] != ^a {
+		return 0, 0, ErrBadValue
+	}
+	return int32(v), a, nil
+}
+
+// AccessBits are the C1 C2 C3 access condition bits of a block, C1 being the most significant.
+type AccessBits uint8
+
+const (
+	// data blocks
+	ACCESS_DATA_ANY       AccessBits = 0x00 // read/write/inc/dec with key A|B
+	ACCESS_DATA_READ_ONLY AccessBits = 0x02 // read with key A|B
+	ACCESS_DATA_B_WRITE   AccessBits = 0x04 // read A|B, write B
+	ACCESS_DATA_VALUE     AccessBits = 0x06 // read A|B, write B, inc B, dec A|B
+	ACCESS_DATA_VALUE_DEC AccessBits = 0x01 // read A|B, dec A|B
+	ACCESS_DATA_B_ONLY    AccessBits = 0x03 // read/write with key B
+	ACCESS_DATA_B_READ    AccessBits = 0x05 // read with key B
+	ACCESS_DATA_NEVER     AccessBits = 0x07 // no access
+
+	// sector trailer
+	ACCESS_TRAILER_TRANSPORT AccessBits = 0x01 // key A writes keys and access bits, key B readable
+	ACCESS_TRAILER_B_WRITE   AccessBits = 0x03 // key B writes keys and access bits
+	ACCESS_TRAILER_READ_ONLY AccessBits = 0x06 // access bits readable, nothing writable
+)
+
+// EncodeAccessBits returns bytes 6..8 of a sector trailer.
+// access[0..2] are the data blocks (or groups of 5 blocks on 4K large sectors), access[3] the trailer.
+func EncodeAccessBits(access [4]AccessBits) [3]byte {
+	var c1, c2, c3 uint8
+	for i, a := range access {
+		c1 |= uint8(a>>2&1) << i
+		c2 |= uint8(a>>1&1) << i
+		c3 |= uint8(a&1) << i
+	}
+	return [3]byte{
+		(^c2&0x0F)<<4 | ^c1&0x0F,
+		c1<<4 | ^c3&0x0F,
+		c3<<4 | c2,
+	}
+}
+
+// DecodeAccessBits parses bytes 6..8 of a sector trailer and checks their inverted copies.
+func DecodeAccessBits(b []byte) ([4]AccessBits, error) {
+	var access [4]AccessBits
+	if len(b) < 3 {
+		return access, ErrBadTrail
+	}
+	c1 := b[1] >> 4
+	c2 := b[2] & 0x0F
+	c3 := b[2] >> 4
+	if b[0]&0x0F != ^c1&0x0F || b[0]>>4 != ^c2&0x0F || b[1]&0x0F != ^c3&0x0F {
+		return access, ErrBadTrail
+	}
+	for i := range access {
+		access[i] = AccessBits((c1>>i&1)<<2 | (c2>>i&1)<<1 | c3>>i&1)
+	}
+	return access, nil
+}
+
+// SectorTrailer is the last block of a sector.
+// Key A is never readable, it reads as zeros.
+type SectorTrailer struct {
+	KeyA   Key
+	Access [4]AccessBits
+	GPB    byte // general purpose byte
+	KeyB   Key
+}
+
+// Encode returns the 16 bytes of the sector trailer block.
+func (t *SectorTrailer) Encode() [MF_BLOCK_SIZE]byte {
+	var b [MF_BLOCK_SIZE]byte
+	copy(b[0:6], t.KeyA[:])
+	a := EncodeAccessBits(t.Access)
+	copy(b[6:9], a[:])
+	b[9] = t.GPB
+	copy(b[10:16], t.KeyB[:])
+	return b
+}
+
+// DecodeSectorTrailer parses the 16 bytes of a sector trailer block.
+func DecodeSectorTrailer(data []byte) (*SectorTrailer, error) {
+	if len(data) != MF_BLOCK_SIZE {
+		return nil, ErrBadTrail
+	}
+	access, err := DecodeAccessBits(data[6:9])
+	if err != nil {
+		return nil, err
+	}
+	t := &SectorTrailer{Access: access, GPB: data[9]}
+	copy(t.KeyA[:], data[0:6])
+	copy(t.KeyB[:], data[10:16])
+	return t, nil
+}
+
+// SectorFirstBlock returns the first block of a sector, 1K cards use sectors 0..15,
+// 4K cards 0..39 with sectors 32..39 made of 16 blocks.
+func SectorFirstBlock(sector int) uint8 {
+	if sector < 32 {
+		return uint8(sector * 4)
+	}
+	return uint8(128 + (sector-32)*16)
+}
+
+// SectorTrailerBlock returns the trailer block of a sector.
+func SectorTrailerBlock(sector int) uint8 {
+	if sector < 32 {
+		return SectorFirstBlock(sector) + 3
+	}
+	return SectorFirstBlock(sector) + 15
+}
+
+// BlockSector returns the sector of a block.
+func BlockSector(block uint8) int {
+	if block < 128 {
+		return int(block) / 4
+	}
+	return 32 + (int(block)-128)/16
+}
+
+// WriteSectorTrailer writes the keys and access bits of the authenticated sector.
+// Access conditions are checked before writing, an access bits value above 7
+// would be truncated by Encode. Trailer conditions other than
+// ACCESS_TRAILER_TRANSPORT, ACCESS_TRAILER_B_WRITE and 0x05 make the access
+// bits read-only for good.
+func (h *Dev) WriteSectorTrailer(sector int, t *SectorTrailer) error {
+	if sector < 0 || sector > 39 {
+		return deverr.Paramf("sector %d out of range (0..39)", sector)
+	}
+	for i, a := range t.Access {
+		if a > 7 {
+			return deverr.Paramf("access bits 0x%02x of block %d out of range (0..7)", uint8(a), i)
+		}
+	}
+	data := t.Encode()
+	return h.WriteBlock(SectorTrailerBlock(sector), data[:])
+}
@@ -0,0 +1,359 @@
+package rfid2_unit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// NDEF TLV blocks, NFC Forum type 2 tag
+const (
+	TLV_NULL        = 0x00
+	TLV_LOCK_CTRL   = 0x01
+	TLV_MEMORY_CTRL = 0x02
+	TLV_NDEF        = 0x03
+	TLV_PROPRIETARY = 0xFD
+	TLV_TERMINATOR  = 0xFE
+)
+
+// NDEF record header flags
+const (
+	NDEF_MB  = 0x80 // message begin
+	NDEF_ME  = 0x40 // message end
+	NDEF_CF  = 0x20 // chunk flag
+	NDEF_SR  = 0x10 // short record
+	NDEF_IL  = 0x08 // ID length present
+	NDEF_TNF = 0x07
+)
+
+// Type name formats
+const (
+	TNF_EMPTY        = 0x00
+	TNF_WELL_KNOWN   = 0x01
+	TNF_MIME         = 0x02
+	TNF_ABSOLUTE_URI = 0x03
+	TNF_EXTERNAL     = 0x04
+	TNF_UNKNOWN      = 0x05
+	TNF_UNCHANGED    = 0x06
+)
+
+var (
+	ErrNdef          = errors.New("malformed NDEF data")
+	ErrNdefTruncated = errors.New("NDEF data truncated")
+	ErrNdefNotFound  = errors.New("no NDEF message")
+)
+
+// uriPrefixes are the URI identifier codes of the NFC Forum URI RTD.
+var uriPrefixes = []string{
+	"",
+	"http://www.",
+	"https://www.",
+	"http://",
+	"https://",
+	"tel:",
+	"mailto:",
+	"ftp://anonymous:anonymous@",
+	"ftp://ftp.",
+	"ftps://",
+	"sftp://",
+	"smb://",
+	"nfs://",
+	"ftp://",
+	"dav://",
+	"news:",
+	"telnet://",
+	"imap:",
+	"rtsp://",
+	"urn:",
+	"pop:",
+	"sip:",
+	"sips:",
+	"tftp:",
+	"btspp://",
+	"btl2cap://",
+	"btgoep://",
+	"tcpobex://",
+	"irdaobex://",
+	"file://",
+	"urn:epc:id:",
+	"urn:epc:tag:",
+	"urn:epc:pat:",
+	"urn:epc:raw:",
+	"urn:epc:",
+	"urn:nfc:",
+}
+
+// NdefRecord is a record of a NDEF message.
+// Decoding returns *URIRecord, *TextRecord, *MIMERecord or *RawRecord.
+type NdefRecord interface {
+	Raw() (*RawRecord, error)
+}
+
+// RawRecord is an undecoded NDEF record.
+type RawRecord struct {
+	TNF     uint8
+	Type    []byte
+	ID      []byte
+	Payload []byte
+}
+
+// Raw implements NdefRecord.
+func (r *RawRecord) Raw() (*RawRecord, error) {
+	return r, nil
+}
+
+// URIRecord is a well known "U" record.
+type URIRecord struct {
+	URI string
+}
+
+// Raw implements NdefRecord.
+func (r *URIRecord) Raw() (*RawRecord, error) {
+	code := 0
+	for i, p := range uriPrefixes {
+		if len(p) > len(uriPrefixes[code]) && strings.HasPrefix(r.URI, p) {
+			code = i
+		}
+	}
+	payload := append([]byte{byte(code)}, r.URI[len(uriPrefixes[code]):]...)
+	return &RawRecord{TNF: TNF_WELL_KNOWN, Type: []byte("U"), Payload: payload}, nil
+}
+
+// TextRecord is a well known "T" record.
+type TextRecord struct {
+	Lang string // IANA language code, e.g. "en"
+	Text string
+}
+
+// Raw implements NdefRecord, the text is UTF-8 encoded.
+func (r *TextRecord) Raw() (*RawRecord, error) {
+	if len(r.Lang) > 0x3F {
+		return nil, fmt.Errorf("%w: language code too long", ErrNdef)
+	}
+	payload := append([]byte{byte(len(r.Lang))}, r.Lang...)
+	payload = append(payload, r.Text...)
+	return &RawRecord{TNF: TNF_WELL_KNOWN, Type: []byte("T"), Payload: payload}, nil
+}
+
+// MIMERecord is a media-type record.
+type MIMERecord struct {
+	Type string // e.g. "application/json"
+	Data []byte
+}
+
+// Raw implements NdefRecord.
+func (r *MIMERecord) Raw() (*RawRecord, error) {
+	return &RawRecord{TNF: TNF_MIME, Type: []byte(r.Type), Payload: r.Data}, nil
+}
+
+// typed converts a raw record to its typed form when known.
+func (r *RawRecord) typed() (NdefRecord, error) {
+	switch {
+	case r.TNF == TNF_WELL_KNOWN && string(r.Type) == "U":
+		if len(r.Payload) < 1 {
+			return nil, fmt.Errorf("%w: empty URI record", ErrNdef)
+		}
+		prefix := ""
+		if int(r.Payload[0]) < len(uriPrefixes) {
+			prefix = uriPrefixes[r.Payload[0]]
+		}
+		return &URIRecord{URI: prefix + string(r.Payload[1:])}, nil
+	case r.TNF == TNF_WELL_KNOWN && string(r.Type) == "T":
+		if len(r.Payload) < 1 {
+			return nil, fmt.Errorf("%w: empty text record", ErrNdef)
+		}
+		status := r.Payload[0]
+		l := int(status & 0x3F)
+		if 1+l > len(r.Payload) {
+			return nil, fmt.Errorf("%w: text record language", ErrNdef)
+		}
+		t := &TextRecord{Lang: string(r.Payload[1 : 1+l])}
+		text := r.Payload[1+l:]
+		if status&0x80 == 0 {
+			t.Text = string(text)
+			return t, nil
+		}
+		// UTF-16, big endian unless a BOM says otherwise
+		var order binary.ByteOrder = binary.BigEndian
+		if len(text) >= 2 && text[0] == 0xFF && text[1] == 0xFE {
+			order = binary.LittleEndian
+			text = text[2:]
+		} else if len(text) >= 2 && text[0] == 0xFE && text[1] == 0xFF {
+			text = text[2:]
+		}
+		u := make([]uint16, len(text)/2)
+		for i := range u {
+			u[i] = order.Uint16(text[2*i:])
+		}
+		t.Text = string(utf16.Decode(u))
+		return t, nil
+	case r.TNF == TNF_MIME:
+		return &MIMERecord{Type: string(r.Type), Data: r.Payload}, nil
+	}
+	return r, nil
+}
+
+// EncodeNdefMessage serializes records as a NDEF message.
+func EncodeNdefMessage(records ...NdefRecord) ([]byte, error) {
+	if len(records) == 0 {
+		// empty NDEF message
+		return []byte{NDEF_MB | NDEF_ME | TNF_EMPTY, 0, 0}, nil
+	}
+	var msg []byte
+	for i, rec := range records {
+		r, err := rec.Raw()
+		if err != nil {
+			return nil, err
+		}
+		if len(r.Type) > 0xFF || len(r.ID) > 0xFF {
+			return nil, fmt.Errorf("%w: type or ID too long", ErrNdef)
+		}
+		header := r.TNF & NDEF_TNF
+		if i == 0 {
+			header |= NDEF_MB
+		}
+		if i == len(records)-1 {
+			header |= NDEF_ME
+		}
+		if len(r.Payload) < 0x100 {
+			header |= NDEF_SR
+		}
+		if len(r.ID) > 0 {
+			header |= NDEF_IL
+		}
+		msg = append(msg, header, byte(len(r.Type)))
+		if header&NDEF_SR != 0 {
+			msg = append(msg, byte(len(r.Payload)))
+		} else {
+			l := make([]byte, 4)
+			binary.BigEndian.PutUint32(l, uint32(len(r.Payload)))
+			msg = append(msg, l...)
+		}
+		if len(r.ID) > 0 {
+			msg = append(msg, byte(len(r.ID)))
+		}
+		msg = append(msg, r.Type...)
+		msg = append(msg, r.ID...)
+		msg = append(msg, r.Payload...)
+	}
+	return msg, nil
+}
+
+// DecodeNdefMessage parses a NDEF message into typed records.
+// Chunked records are not supported.
+func DecodeNdefMessage(msg []byte) ([]NdefRecord, error) {
+	var records []NdefRecord
+	if len(msg) == 0 {
+		// initialised tag without message
+		return records, nil
+	}
+	for i := 0; i < len(msg); {
+		header := msg[i]
+		if i == 0 && header&NDEF_MB == 0 {
+			return nil, fmt.Errorf("%w: missing message begin", ErrNdef)
+		}
+		if header&NDEF_CF != 0 {
+			return nil, fmt.Errorf("%w: chunked records are not supported", ErrNdef)
+		}
+		i++
+		if i >= len(msg) {
+			return nil, ErrNdefTruncated
+		}
+		typeLen := int(msg[i])
+		i++
+		var payloadLen int
+		if header&NDEF_SR != 0 {
+			if i >= len(msg) {
+				return nil, ErrNdefTruncated
+			}
+			payloadLen = int(msg[i])
+			i++
+		} else {
+			if i+4 > len(msg) {
+				return nil, ErrNdefTruncated
+			}
+			payloadLen = int(binary.BigEndian.Uint32(msg[i:]))
+			i += 4
+		}
+		idLen := 0
+		if header&NDEF_IL != 0 {
+			if i >= len(msg) {
+				return nil, ErrNdefTruncated
+			}
+			idLen = int(msg[i])
+			i++
+		}
+		if payloadLen < 0 || i+typeLen+idLen+payloadLen > len(msg) {
+			return nil, ErrNdefTruncated
+		}
+		r := &RawRecord{TNF: header & NDEF_TNF}
+		r.Type = msg[i : i+typeLen]
+		i += typeLen
+		if idLen > 0 {
+			r.ID = msg[i : i+idLen]
+			i += idLen
+		}
+		r.Payload = msg[i : i+payloadLen]
+		i += payloadLen
+		if r.TNF != TNF_EMPTY {
+			rec, err := r.typed()
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rec)
+		}
+		if header&NDEF_ME != 0 {
+			return records, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: missing message end", ErrNdef)
+}
+
+// EncodeNdefTLV wraps a NDEF message in a NDEF TLV followed by a terminator TLV.
+func EncodeNdefTLV(msg []byte) []byte {
+	var tlv []byte
+	if len(msg) < 0xFF {
+		tlv = []byte{TLV_NDEF, byte(len(msg))}
+	} else {
+		tlv = []byte{TLV_NDEF, 0xFF, byte(len(msg) >> 8), byte(len(msg))}
+	}
+	tlv = append(tlv, msg...)
+	return append(tlv, TLV_TERMINATOR)
+}
+
+// FindNdefTLV scans the data area of a type 2 tag and returns the first NDEF message.
+// ErrNdefTruncated means that more data must be read.
+func FindNdefTLV(mem []byte) ([]byte, error) {
+	for i := 0; i < len(mem); {
+		t := mem[i]
+		i++
+		switch t {
+		case TLV_NULL:
+			continue
+		case TLV_TERMINATOR:
+			return nil, ErrNdefNotFound
+		}
+		if i >= len(mem) {
+			return nil, ErrNdefTruncated
+		}
+		l := int(mem[i])
+		i++
+		if l == 0xFF {
+			if i+2 > len(mem) {
+				return nil, ErrNdefTruncated
+			}
+			l = int(binary.BigEndian.Uint16(mem[i:]))
+			i += 2
+		}
+		if i+l > len(mem) {
+			return nil, ErrNdefTruncated
+		}
+		if t == TLV_NDEF {
+			return mem[i : i+l], nil
+		}
+		i += l
+	}
+	return nil, ErrNdefTruncated
+}
@@ -0,0 +1,246 @@
+package rfid2_unit
+
+import (
+	"errors"
+	"fmt"
+
+	"devices/deverr"
+)
+
+// MIFARE Ultralight and NTAG21x commands
+const (
+	PICC_CMD_UL_READ     = 0x30
+	PICC_CMD_UL_WRITE    = 0xA2
+	PICC_CMD_GET_VERSION = 0x60
+	PICC_CMD_PWD_AUTH    = 0x1B
+
+	UL_PAGE_SIZE       = 4
+	UL_FIRST_USER_PAGE = 4
+	UL_CC_PAGE         = 3
+)
+
+// TagType is the Ultralight family member detected by GET_VERSION.
+type TagType int
+
+const (
+	TAG_UNKNOWN TagType = iota
+	TAG_ULTRALIGHT
+	TAG_ULTRALIGHT_EV1_MF0UL11
+	TAG_ULTRALIGHT_EV1_MF0UL21
+	TAG_NTAG213
+	TAG_NTAG215
+	TAG_NTAG216
+)
+
+// TagInfo describes the memory layout of a tag.
+type TagInfo struct {
+	Name          string
+	Pages         int   // total number of pages
+	LastUserPage  uint8 // last page of user memory
+	ConfigPage    uint8 // CFG0 page holding AUTH0, 0 if no password protection
+	PasswordPage  uint8 // PWD page, PACK is the next one
+	UserMemoryLen int   // bytes of user memory
+}
+
+var tagInfos = map[TagType]TagInfo{
+	TAG_ULTRALIGHT:             {Name: "MIFARE Ultralight", Pages: 16, LastUserPage: 15},
+	TAG_ULTRALIGHT_EV1_MF0UL11: {Name: "MIFARE Ultralight EV1 MF0UL11", Pages: 20, LastUserPage: 15, ConfigPage: 16, PasswordPage: 18},
+	TAG_ULTRALIGHT_EV1_MF0UL21: {Name: "MIFARE Ultralight EV1 MF0UL21", Pages: 41, LastUserPage: 35, ConfigPage: 37, PasswordPage: 39},
+	TAG_NTAG213:                {Name: "NTAG213", Pages: 45, LastUserPage: 39, ConfigPage: 41, PasswordPage: 43},
+	TAG_NTAG215:                {Name: "NTAG215", Pages: 135, LastUserPage: 129, ConfigPage: 131, PasswordPage: 133},
+	TAG_NTAG216:                {Name: "NTAG216", Pages: 231, LastUserPage: 225, ConfigPage: 227, PasswordPage: 229},
+}
+
+// Info returns the memory layout of the tag type.
+func (t TagType) Info() (TagInfo, bool) {
+	info, ok := tagInfos[t]
+	if ok {
+		info.UserMemoryLen = (int(info.LastUserPage) - UL_FIRST_USER_PAGE + 1) * UL_PAGE_SIZE
+	}
+	return info, ok
+}
+
+func (t TagType) String() string {
+	if info, ok := tagInfos[t]; ok {
+		return info.Name
+	}
+	return "unknown"
+}
+
+// TagVersion is the GET_VERSION answer.
+type TagVersion struct {
+	Header      uint8
+	Vendor      uint8 // 0x04 NXP
+	ProductType uint8 // 0x03 Ultralight, 0x04 NTAG
+	SubType     uint8
+	Major       uint8
+	Minor       uint8
+	StorageSize uint8
+	Protocol    uint8
+}
+
+// TagType maps the version to a known tag.
+func (v *TagVersion) TagType() TagType {
+	if v.Vendor != 0x04 {
+		return TAG_UNKNOWN
+	}
+	switch {
+	case v.ProductType == 0x03 && v.StorageSize == 0x0B:
+		return TAG_ULTRALIGHT_EV1_MF0UL11
+	case v.ProductType == 0x03 && v.StorageSize == 0x0E:
+		return TAG_ULTRALIGHT_EV1_MF0UL21
+	case v.ProductType == 0x04 && v.StorageSize == 0x0F:
+		return TAG_NTAG213
+	case v.ProductType == 0x04 && v.StorageSize == 0x11:
+		return TAG_NTAG215
+	case v.ProductType == 0x04 && v.StorageSize == 0x13:
+		return TAG_NTAG216
+	}
+	return TAG_UNKNOWN
+}
+
+// ReadPages reads 4 pages (16 bytes) starting at page, rolling over at the end of memory.
+func (h *Dev) ReadPages(page uint8) ([]byte, error) {
+	return h.ReadBlock(page)
+}
+
+// WritePage writes the 4 bytes of a page.
+func (h *Dev) WritePage(page uint8, data []byte) error {
+	if len(data) != UL_PAGE_SIZE {
+		return deverr.Paramf("page data must be %d bytes", UL_PAGE_SIZE)
+	}
+	return h.mifareTransceive(append([]byte{PICC_CMD_UL_WRITE, page}, data...), false)
+}
+
+// GetTagVersion sends GET_VERSION to the selected tag.
+// Tags that do not support it (plain Ultralight) go back to IDLE state.
+func (h *Dev) GetTagVersion() (*TagVersion, error) {
+	back, bits, err := h.transceive(appendCRC([]byte{PICC_CMD_GET_VERSION}), 0, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(back) == 1 && bits == 4 {
+		return nil, fmt.Errorf("%w: 0x%x", ErrNAK, back[0]&0x0F)
+	}
+	if back, err = stripCRC(back); err != nil {
+		return nil, err
+	}
+	if len(back) != 8 {
+		return nil, fmt.Errorf("%w: version length %d", ErrProtocol, len(back))
+	}
+	return &TagVersion{
+		Header:      back[0],
+		Vendor:      back[1],
+		ProductType: back[2],
+		SubType:     back[3],
+		Major:       back[4],
+		Minor:       back[5],
+		StorageSize: back[6],
+		Protocol:    back[7],
+	}, nil
+}
+
+// GetTagType detects the type of the selected Ultralight family tag.
+// If the tag does not answer GET_VERSION it is a plain Ultralight,
+// it is then woken up and selected again so that it can be used.
+func (h *Dev) GetTagType() (TagType, error) {
+	v, err := h.GetTagVersion()
+	if err == nil {
+		return v.TagType(), nil
+	}
+	if !errors.Is(err, ErrNAK) && !errors.Is(err, ErrTimeout) {
+		return TAG_UNKNOWN, err
+	}
+	if _, err := h.WakeupA(); err != nil {
+		return TAG_UNKNOWN, err
+	}
+	if _, _, err := h.Select(); err != nil {
+		return TAG_UNKNOWN, err
+	}
+	return TAG_ULTRALIGHT, nil
+}
+
+// PwdAuth authenticates with the 32 bits password and returns the 16 bits PACK.
+func (h *Dev) PwdAuth(pwd [4]byte) ([2]byte, error) {
+	var pack [2]byte
+	back, bits, err := h.transceive(appendCRC(append([]byte{PICC_CMD_PWD_AUTH}, pwd[:]...)), 0, false)
+	if err != nil {
+		if errors.Is(err, ErrTimeout) {
+			return pack, ErrAuth
+		}
+		return pack, err
+	}
+	if len(back) == 1 && bits == 4 {
+		return pack, ErrAuth
+	}
+	if back, err = stripCRC(back); err != nil {
+		return pack, err
+	}
+	if len(back) != 2 {
+		return pack, fmt.Errorf("%w: PACK length %d", ErrProtocol, len(back))
+	}
+	copy(pack[:], back)
+	return pack, nil
+}
+
+// ReadNdef reads the NDEF message of a NFC Forum type 2 tag.
+func (h *Dev) ReadNdef() ([]NdefRecord, error) {
+	size, err := h.ndefAreaSize()
+	if err != nil {
+		return nil, err
+	}
+	var mem []byte
+	for page := UL_FIRST_USER_PAGE; len(mem) < size; page += 4 {
+		data, err := h.ReadPages(uint8(page))
+		if err != nil {
+			return nil, err
+		}
+		mem = append(mem, data...)
+		msg, err := FindNdefTLV(mem)
+		if errors.Is(err, ErrNdefTruncated) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return DecodeNdefMessage(msg)
+	}
+	return nil, ErrNdefTruncated
+}
+
+// WriteNdef writes records as the NDEF message of a NFC Forum type 2 tag.
+func (h *Dev) WriteNdef(records ...NdefRecord) error {
+	size, err := h.ndefAreaSize()
+	if err != nil {
+		return err
+	}
+	msg, err := EncodeNdefMessage(records...)
+	if err != nil {
+		return err
+	}
+	tlv := EncodeNdefTLV(msg)
+	if len(tlv) > size {
+		return deverr.Paramf("NDEF message too long: %d bytes, tag holds %d", len(tlv), size)
+	}
+	for len(tlv)%UL_PAGE_SIZE != 0 {
+		tlv = append(tlv, 0)
+	}
+	for i := 0; i < len(tlv); i += UL_PAGE_SIZE {
+		if err := h.WritePage(uint8(UL_FIRST_USER_PAGE+i/UL_PAGE_SIZE), tlv[i:i+UL_PAGE_SIZE]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ndefAreaSize reads the capability container and returns the data area size in bytes.
+func (h *Dev) ndefAreaSize() (int, error) {
+	data, err := h.ReadPages(UL_CC_PAGE)
+	if err != nil {
+		return 0, err
+	}
+	if data[0] != 0xE1 {
+		return 0, fmt.Errorf("%w: no capability container", ErrNdef)
+	}
+	return int(data[2]) * 8, nil
+}
@@ -1 +1,522 @@
 package rfid2_unit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+// WS1850S/MFRC522 registers
+const (
+	RFID2_I2C_ADDR = 0x28
+
+	COMMAND_REG      = 0x01
+	COM_IEN_REG      = 0x02
+	DIV_IEN_REG      = 0x03
+	COM_IRQ_REG      = 0x04
+	DIV_IRQ_REG      = 0x05
+	ERROR_REG        = 0x06
+	STATUS1_REG      = 0x07
+	STATUS2_REG      = 0x08
+	FIFO_DATA_REG    = 0x09
+	FIFO_LEVEL_REG   = 0x0A
+	CONTROL_REG      = 0x0C
+	BIT_FRAMING_REG  = 0x0D
+	COLL_REG         = 0x0E
+	MODE_REG         = 0x11
+	TX_MODE_REG      = 0x12
+	RX_MODE_REG      = 0x13
+	TX_CONTROL_REG   = 0x14
+	TX_ASK_REG       = 0x15
+	CRC_RESULT_H_REG = 0x21
+	CRC_RESULT_L_REG = 0x22
+	MOD_WIDTH_REG    = 0x24
+	RF_CFG_REG       = 0x26
+	T_MODE_REG       = 0x2A
+	T_PRESCALER_REG  = 0x2B
+	T_RELOAD_H_REG   = 0x2C
+	T_RELOAD_L_REG   = 0x2D
+	VERSION_REG      = 0x37
+)
+
+// PCD (reader) commands, written to COMMAND_REG
+const (
+	PCD_IDLE        = 0x00
+	PCD_MEM         = 0x01
+	PCD_CALC_CRC    = 0x03
+	PCD_TRANSMIT    = 0x04
+	PCD_RECEIVE     = 0x08
+	PCD_TRANSCEIVE  = 0x0C
+	PCD_MF_AUTHENT  = 0x0E
+	PCD_SOFT_RESET  = 0x0F
+	PCD_POWER_DOWN  = 0x10 // bit in COMMAND_REG
+	PCD_START_SEND  = 0x80 // bit in BIT_FRAMING_REG
+	PCD_FLUSH_FIFO  = 0x80 // bit in FIFO_LEVEL_REG
+	PCD_ANTENNA_TX  = 0x03 // Tx1RFEn | Tx2RFEn in TX_CONTROL_REG
+	PCD_COLL_VALUES = 0x80 // ValuesAfterColl in COLL_REG
+)
+
+// PICC (card) commands, ISO/IEC 14443-3 type A
+const (
+	PICC_CMD_REQA    = 0x26
+	PICC_CMD_WUPA    = 0x52
+	PICC_CMD_CT      = 0x88 // cascade tag
+	PICC_CMD_SEL_CL1 = 0x93
+	PICC_CMD_SEL_CL2 = 0x95
+	PICC_CMD_SEL_CL3 = 0x97
+	PICC_CMD_HLTA    = 0x50
+)
+
+// RxGain is the receiver gain stored in RF_CFG_REG.
+type RxGain byte
+
+const (
+	RX_GAIN_18DB RxGain = 0x00
+	RX_GAIN_23DB RxGain = 0x10
+	RX_GAIN_33DB RxGain = 0x40
+	RX_GAIN_38DB RxGain = 0x50
+	RX_GAIN_43DB RxGain = 0x60
+	RX_GAIN_48DB RxGain = 0x70
+)
+
+var (
+	ErrTimeout   = errors.New("timeout in communication with PICC")
+	ErrCollision = errors.New("collision detected")
+	ErrCRC       = errors.New("CRC_A does not match")
+	ErrNoRoom    = errors.New("response does not fit the buffer")
+	ErrProtocol  = errors.New("protocol error")
+)
+
+// I2CAddr is the default I2C address for the m5stack RFID2 unit.
+const I2CAddr uint16 = RFID2_I2C_ADDR
+
+// Opts holds the configuration options.
+type Opts struct {
+	I2cAddress  uint16
+	AntennaGain RxGain
+}
+
+// DefaultOpts are the recommended default options.
+var DefaultOpts = Opts{
+	I2cAddress:  I2CAddr,
+	AntennaGain: RX_GAIN_33DB,
+}
+
+// Card is a PICC answering to REQA/WUPA and selected by SELECT.
+type Card struct {
+	UID  []byte // 4, 7 or 10 bytes
+	ATQA uint16
+	SAK  byte
+}
+
+// Dev is an handle to an M5Stack RFID2 (WS1850S) unit driver.
+type Dev struct {
+	c i2c.Dev
+}
+
+// New creates a new driver.
+func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
+	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x70 {
+		return nil, deverr.Paramf("invalid device address")
+	}
+
+	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}
+	if err := dev.Reset(); err != nil {
+		return nil, err
+	}
+	// 25ms timeout: TPrescaler = 0xA9 (40kHz), TReload = 1000
+	init := [][2]byte{
+		{TX_MODE_REG, 0x00},
+		{RX_MODE_REG, 0x00},
+		{MOD_WIDTH_REG, 0x26},
+		{T_MODE_REG, 0x80},
+		{T_PRESCALER_REG, 0xA9},
+		{T_RELOAD_H_REG, 0x03},
+		{T_RELOAD_L_REG, 0xE8},
+		{TX_ASK_REG, 0x40}, // 100% ASK
+		{MODE_REG, 0x3D},   // CRC preset 0x6363
+	}
+	for _, r := range init {
+		if err := dev.writeReg(int(r[0]), r[1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := dev.SetAntennaGain(opts.AntennaGain); err != nil {
+		return nil, err
+	}
+	if err := dev.AntennaOn(); err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
+
+func (h *Dev) Close() {
+	if h != nil {
+		h.AntennaOff()
+	}
+}
+
+func (h *Dev) readBytes(reg int, size int) ([]uint8, error) {
+	r := make([]byte, size)
+	err := h.c.Tx([]byte{byte(reg)}, r)
+	if err != nil {
+		return r, deverr.Bus(h.c.Addr, fmt.Sprintf("read register 0x%02x", reg), err)
+	}
+	return r, nil
+}
+
+func (h *Dev) writeBytes(reg int, data []uint8) error {
+	d := []byte{byte(reg)}
+	d = append(d, data...)
+	if err := h.c.Tx(d, nil); err != nil {
+		return deverr.Bus(h.c.Addr, fmt.Sprintf("write register 0x%02x", reg), err)
+	}
+	return nil
+}
+
+func (h *Dev) readReg(reg int) (uint8, error) {
+	data, err := h.readBytes(reg, 1)
+	if err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+func (h *Dev) writeReg(reg int, value uint8) error {
+	return h.writeBytes(reg, []uint8{value})
+}
+
+func (h *Dev) clearBits(reg int, mask uint8) error {
+	v, err := h.readReg(reg)
+	if err != nil {
+		return err
+	}
+	return h.writeReg(reg, v&^mask)
+}
+
+// Reset issues a soft reset and waits for the oscillator to restart.
+func (h *Dev) Reset() error {
+	if err := h.writeReg(COMMAND_REG, PCD_SOFT_RESET); err != nil {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		v, err := h.readReg(COMMAND_REG)
+		if err != nil {
+			return err
+		}
+		if v&PCD_POWER_DOWN == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: soft reset timeout", deverr.ErrDevice)
+}
+
+// GetVersion returns the content of VERSION_REG (0x15 for WS1850S, 0x91/0x92 for MFRC522).
+func (h *Dev) GetVersion() (uint8, error) {
+	return h.readReg(VERSION_REG)
+}
+
+func (h *Dev) AntennaOn() error {
+	v, err := h.readReg(TX_CONTROL_REG)
+	if err != nil {
+		return err
+	}
+	if v&PCD_ANTENNA_TX == PCD_ANTENNA_TX {
+		return nil
+	}
+	return h.writeReg(TX_CONTROL_REG, v|PCD_ANTENNA_TX)
+}
+
+func (h *Dev) AntennaOff() error {
+	return h.clearBits(TX_CONTROL_REG, PCD_ANTENNA_TX)
+}
+
+func (h *Dev) GetAntennaGain() (RxGain, error) {
+	v, err := h.readReg(RF_CFG_REG)
+	if err != nil {
+		return 0, err
+	}
+	return RxGain(v & 0x70), nil
+}
+
+func (h *Dev) SetAntennaGain(gain RxGain) error {
+	v, err := h.readReg(RF_CFG_REG)
+	if err != nil {
+		return err
+	}
+	return h.writeReg(RF_CFG_REG, (v&^0x70)|uint8(gain&0x70))
+}
+
+// communicate runs a PCD command that exchanges data with the PICC.
+// validBits is the number of bits of the last sent byte (0 means 8),
+// rxAlign the bit position of the first received bit.
+// It returns the FIFO content and the number of valid bits in the last
+// received byte. On collision the received data is returned along with ErrCollision.
+func (h *Dev) communicate(cmd uint8, waitIRq uint8, send []byte, validBits uint8, rxAlign uint8) ([]byte, uint8, error) {
+	if err := h.writeReg(COMMAND_REG, PCD_IDLE); err != nil {
+		return nil, 0, err
+	}
+	if err := h.writeReg(COM_IRQ_REG, 0x7F); err != nil {
+		return nil, 0, err
+	}
+	if err := h.writeReg(FIFO_LEVEL_REG, PCD_FLUSH_FIFO); err != nil {
+		return nil, 0, err
+	}
+	if err := h.writeBytes(FIFO_DATA_REG, send); err != nil {
+		return nil, 0, err
+	}
+	framing := rxAlign<<4 | validBits
+	if err := h.writeReg(BIT_FRAMING_REG, framing); err != nil {
+		return nil, 0, err
+	}
+	if err := h.writeReg(COMMAND_REG, cmd); err != nil {
+		return nil, 0, err
+	}
+	if cmd == PCD_TRANSCEIVE {
+		if err := h.writeReg(BIT_FRAMING_REG, framing|PCD_START_SEND); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// The timer set up in New expires after 25ms, wait a bit longer than that.
+	deadline := time.Now().Add(40 * time.Millisecond)
+	for {
+		irq, err := h.readReg(COM_IRQ_REG)
+		if err != nil {
+			return nil, 0, err
+		}
+		if irq&waitIRq != 0 {
+			break
+		}
+		if irq&0x01 != 0 { // TimerIRq
+			return nil, 0, ErrTimeout
+		}
+		if time.Now().After(deadline) {
+			return nil, 0, fmt.Errorf("%w: PCD did not complete command 0x%02x", deverr.ErrDevice, cmd)
+		}
+	}
+
+	errReg, err := h.readReg(ERROR_REG)
+	if err != nil {
+		return nil, 0, err
+	}
+	if errReg&0x13 != 0 { // BufferOvfl, ParityErr, ProtocolErr
+		return nil, 0, fmt.Errorf("%w: error register 0x%02x", ErrProtocol, errReg)
+	}
+	if cmd != PCD_TRANSCEIVE && cmd != PCD_RECEIVE {
+		return nil, 0, nil
+	}
+
+	n, err := h.readReg(FIFO_LEVEL_REG)
+	if err != nil {
+		return nil, 0, err
+	}
+	var back []byte
+	if n > 0 {
+		if back, err = h.readBytes(FIFO_DATA_REG, int(n&0x7F)); err != nil {
+			return nil, 0, err
+		}
+	}
+	ctrl, err := h.readReg(CONTROL_REG)
+	if err != nil {
+		return nil, 0, err
+	}
+	if errReg&0x08 != 0 { // CollErr
+		return back, ctrl & 0x07, ErrCollision
+	}
+	return back, ctrl & 0x07, nil
+}
+
+// transceive sends data to the PICC and returns its answer.
+// If checkCRC is set the trailing CRC_A of the answer is verified and stripped.
+func (h *Dev) transceive(send []byte, validBits uint8, checkCRC bool) ([]byte, uint8, error) {
+	back, bits, err := h.communicate(PCD_TRANSCEIVE, 0x30, send, validBits, 0)
+	if err != nil {
+		return back, bits, err
+	}
+	if !checkCRC {
+		return back, bits, nil
+	}
+	if bits != 0 {
+		return nil, 0, ErrCRC
+	}
+	back, err = stripCRC(back)
+	return back, 0, err
+}
+
+// stripCRC verifies and removes the trailing CRC_A.
+func stripCRC(data []byte) ([]byte, error) {
+	if len(data) < 3 {
+		return nil, ErrCRC
+	}
+	l := len(data) - 2
+	crc := crcA(data[:l])
+	if data[l] != crc[0] || data[l+1] != crc[1] {
+		return nil, ErrCRC
+	}
+	return data[:l], nil
+}
+
+// crcA computes the ISO/IEC 14443-3 CRC_A, least significant byte first.
+func crcA(data []byte) [2]byte {
+	crc := uint16(0x6363)
+	for _, b := range data {
+		b ^= byte(crc)
+		b ^= b << 4
+		crc = crc>>8 ^ uint16(b)<<8 ^ uint16(b)<<3 ^ uint16(b)>>4
+	}
+	return [2]byte{byte(crc), byte(crc >> 8)}
+}
+
+func appendCRC(data []byte) []byte {
+	crc := crcA(data)
+	return append(data, crc[0], crc[1])
+}
+
+func (h *Dev) requestOrWakeup(cmd uint8) (uint16, error) {
+	if err := h.clearBits(COLL_REG, PCD_COLL_VALUES); err != nil {
+		return 0, err
+	}
+	// REQA and WUPA are 7 bits short frames
+	back, bits, err := h.transceive([]byte{cmd}, 7, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(back) != 2 || bits != 0 {
+		return 0, fmt.Errorf("%w: ATQA length %d", ErrProtocol, len(back))
+	}
+	return uint16(back[1])<<8 | uint16(back[0]), nil
+}
+
+// RequestA sends REQA and returns ATQA of the PICCs in IDLE state.
+func (h *Dev) RequestA() (uint16, error) {
+	return h.requestOrWakeup(PICC_CMD_REQA)
+}
+
+// WakeupA sends WUPA and returns ATQA of the PICCs in IDLE or HALT state.
+func (h *Dev) WakeupA() (uint16, error) {
+	return h.requestOrWakeup(PICC_CMD_WUPA)
+}
+
+// HaltA puts the selected PICC in HALT state.
+func (h *Dev) HaltA() error {
+	_, _, err := h.transceive(appendCRC([]byte{PICC_CMD_HLTA, 0}), 0, false)
+	// The PICC does not answer to HLTA, any answer is a NAK.
+	if errors.Is(err, ErrTimeout) {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("%w: PICC answered HLTA", ErrProtocol)
+	}
+	return err
+}
+
+// Select runs anticollision and SELECT for every cascade level
+// and returns the complete UID (4, 7 or 10 bytes) and SAK.
+// If several PICCs are in the field the one with the highest UID bits on collision is chosen.
+func (h *Dev) Select() ([]byte, uint8, error) {
+	if err := h.clearBits(COLL_REG, PCD_COLL_VALUES); err != nil {
+		return nil, 0, err
+	}
+	var uid []byte
+	levels := []uint8{PICC_CMD_SEL_CL1, PICC_CMD_SEL_CL2, PICC_CMD_SEL_CL3}
+	for _, sel := range levels {
+		var buf [9]byte
+		buf[0] = sel
+		knownBits := 0
+		for knownBits < 32 {
+			// ANTICOLLISION: send the known bits, receive the rest of UID CLn + BCC
+			lastBits := uint8(knownBits % 8)
+			index := 2 + knownBits/8
+			buf[1] = uint8(index<<4) | lastBits
+			used := index
+			if lastBits != 0 {
+				used++
+			}
+			back, _, err := h.communicate(PCD_TRANSCEIVE, 0x30, buf[:used], lastBits, lastBits)
+			if len(back) > 0 {
+				if len(back) > len(buf)-index {
+					return nil, 0, ErrNoRoom
+				}
+				mask := uint8(0xFF << lastBits)
+				buf[index] = buf[index]&^mask | back[0]&mask
+				copy(buf[index+1:], back[1:])
+			}
+			if errors.Is(err, ErrCollision) {
+				coll, err := h.readReg(COLL_REG)
+				if err != nil {
+					return nil, 0, err
+				}
+				if coll&0x20 != 0 { // CollPosNotValid
+					return nil, 0, ErrCollision
+				}
+				pos := int(coll & 0x1F)
+				if pos == 0 {
+					pos = 32
+				}
+				if pos <= knownBits {
+					return nil, 0, fmt.Errorf("%w: collision position %d", ErrProtocol, pos)
+				}
+				// choose the PICC with a 1 at the collision position
+				knownBits = pos
+				bit := (knownBits - 1) % 8
+				buf[1+(knownBits+7)/8] |= 1 << bit
+				continue
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+			knownBits = 32
+		}
+
+		if buf[2]^buf[3]^buf[4]^buf[5] != buf[6] {
+			return nil, 0, fmt.Errorf("%w: wrong BCC", ErrProtocol)
+		}
+		// SELECT
+		buf[1] = 0x70
+		back, _, err := h.transceive(appendCRC(buf[:7:7]), 0, true)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(back) != 1 {
+			return nil, 0, fmt.Errorf("%w: SAK length %d", ErrProtocol, len(back))
+		}
+		sak := back[0]
+		if buf[2] == PICC_CMD_CT {
+			uid = append(uid, buf[3:6]...)
+		} else {
+			uid = append(uid, buf[2:6]...)
+		}
+		if sak&0x04 == 0 { // UID complete
+			return uid, sak, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%w: UID not complete after cascade level 3", ErrProtocol)
+}
+
+// SelectCard looks for a PICC in IDLE state and selects it.
+func (h *Dev) SelectCard() (*Card, error) {
+	atqa, err := h.RequestA()
+	if err != nil {
+		return nil, err
+	}
+	uid, sak, err := h.Select()
+	if err != nil {
+		return nil, err
+	}
+	return &Card{UID: uid, ATQA: atqa, SAK: sak}, nil
+}
+
+// ReadCardUID selects a PICC in the field and returns its UID.
+func (h *Dev) ReadCardUID() ([]byte, error) {
+	card, err := h.SelectCard()
+	if err != nil {
+		return nil, err
+	}
+	return card.UID, nil
+}
@@ -1 +1,421 @@
 package rfid2_unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"devices/deverr"
+	"devices/i2cemu"
+
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/host/v3"
+)
+
+func TestCrcA(t *testing.T) {
+	// HLTA frame from ISO/IEC 14443-3: 50 00 57 CD
+	crc := crcA([]byte{PICC_CMD_HLTA, 0x00})
+	if crc != [2]byte{0x57, 0xCD} {
+		t.Errorf("crcA(HLTA) = % x, want 57 cd", crc)
+	}
+}
+
+// newCardEmu returns a WS1850S register file with a type A PICC in its
+// field. The FIFO and the transceive command are emulated, the PICC answers
+// REQA/WUPA, ANTICOLLISION and SELECT of each cascade level, and HLTA.
+func newCardEmu(uid []byte, atqa uint16) *i2cemu.RegisterFile {
+	var levels [][5]byte
+	for rest := uid; len(rest) > 0; {
+		var cl [5]byte
+		if len(rest) > 4 {
+			cl[0] = PICC_CMD_CT
+			copy(cl[1:4], rest[:3])
+			rest = rest[3:]
+		} else {
+			copy(cl[:4], rest)
+			rest = nil
+		}
+		cl[4] = cl[0] ^ cl[1] ^ cl[2] ^ cl[3]
+		levels = append(levels, cl)
+	}
+	sels := []byte{PICC_CMD_SEL_CL1, PICC_CMD_SEL_CL2, PICC_CMD_SEL_CL3}
+	halted := false
+	var fifo []byte
+
+	// answer returns the PICC answer to frame, nil when it does not answer.
+	answer := func(frame []byte, validBits byte) []byte {
+		if len(frame) == 1 && validBits == 7 {
+			if frame[0] == PICC_CMD_WUPA || frame[0] == PICC_CMD_REQA && !halted {
+				halted = false
+				return []byte{byte(atqa), byte(atqa >> 8)}
+			}
+			return nil
+		}
+		if len(frame) == 4 && frame[0] == PICC_CMD_HLTA {
+			halted = true
+			return nil
+		}
+		for i, cl := range levels {
+			if len(frame) < 2 || frame[0] != sels[i] {
+				continue
+			}
+			switch {
+			case frame[1] == 0x20 && len(frame) == 2:
+				return cl[:]
+			case frame[1] == 0x70 && len(frame) == 9 && bytes.Equal(frame[2:7], cl[:]):
+				if _, err := stripCRC(frame); err != nil {
+					return nil
+				}
+				sak := byte(0x00)
+				if i < len(levels)-1 {
+					sak = 0x04 // cascade bit, UID not complete
+				}
+				return appendCRC([]byte{sak})
+			}
+		}
+		return nil
+	}
+
+	rf := i2cemu.NewRegisterFile()
+	rf.Set(VERSION_REG, 0x15)
+	rf.Next = func(ptr byte) byte {
+		if ptr == FIFO_DATA_REG {
+			return ptr
+		}
+		return ptr + 1
+	}
+	rf.OnWrite(FIFO_DATA_REG, func(_ *i2cemu.RegisterFile, _, v byte) {
+		fifo = append(fifo, v)
+	})
+	rf.OnRead(FIFO_DATA_REG, func(_ *i2cemu.RegisterFile, _ byte) byte {
+		if len(fifo) == 0 {
+			return 0
+		}
+		v := fifo[0]
+		fifo = fifo[1:]
+		return v
+	})
+	rf.OnWrite(FIFO_LEVEL_REG, func(_ *i2cemu.RegisterFile, _, v byte) {
+		if v&PCD_FLUSH_FIFO != 0 {
+			fifo = nil
+		}
+	})
+	rf.OnRead(FIFO_LEVEL_REG, func(_ *i2cemu.RegisterFile, _ byte) byte {
+		return byte(len(fifo))
+	})
+	rf.OnWrite(COM_IRQ_REG, func(rf *i2cemu.RegisterFile, _, _ byte) {
+		rf.Regs[COM_IRQ_REG] = 0 // Set1 is never used, clear the flags
+	})
+	rf.OnWrite(BIT_FRAMING_REG, func(rf *i2cemu.RegisterFile, _, v byte) {
+		if v&PCD_START_SEND == 0 || rf.Regs[COMMAND_REG] != PCD_TRANSCEIVE {
+			return
+		}
+		back := answer(fifo, v&0x07)
+		fifo = back
+		rf.Regs[ERROR_REG] = 0
+		rf.Regs[CONTROL_REG] = 0
+		if back == nil {
+			rf.Regs[COM_IRQ_REG] = 0x01 // TimerIRq
+		} else {
+			rf.Regs[COM_IRQ_REG] = 0x30 // RxIRq | IdleIRq
+		}
+	})
+	return rf
+}
+
+func TestDev_emu(t *testing.T) {
+	b := i2cemu.NewBus()
+	uid := []byte{0x04, 0xA1, 0xB2, 0xC3, 0xD4, 0xE5, 0xF6}
+	b.Attach(I2CAddr, newCardEmu(uid, 0x0044))
+
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.GetVersion(); err != nil || v != 0x15 {
+		t.Errorf("GetVersion() = 0x%02x, %v", v, err)
+	}
+	card, err := m.SelectCard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(card.UID, uid) || card.ATQA != 0x0044 || card.SAK != 0x00 {
+		t.Errorf("SelectCard() = UID % x, ATQA 0x%04x, SAK 0x%02x", card.UID, card.ATQA, card.SAK)
+	}
+
+	if err := m.HaltA(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.RequestA(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("RequestA() of a halted card = %v, want %v", err, ErrTimeout)
+	}
+	if atqa, err := m.WakeupA(); err != nil || atqa != 0x0044 {
+		t.Errorf("WakeupA() = 0x%04x, %v", atqa, err)
+	}
+	if uid2, _, err := m.Select(); err != nil || !bytes.Equal(uid2, uid) {
+		t.Errorf("Select() after WakeupA = % x, %v", uid2, err)
+	}
+}
+
+func TestDev_ReadCardUID(t *testing.T) {
+	// Make sure periph is initialized.
+	if _, err := host.Init(); err != nil {
+		t.Skip(err)
+	}
+
+	// Use i2creg I²C bus registry to find the first available I²C bus.
+	b, err := i2creg.Open("")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer b.Close()
+
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	v, err := m.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Printf("rfid2 version:0x%02x\n", v)
+	card, err := m.SelectCard()
+	if err != nil {
+		t.Skip("no card: ", err)
+	}
+	fmt.Printf("UID:% x ATQA:0x%04x SAK:0x%02x\n", card.UID, card.ATQA, card.SAK)
+}
+
+func TestAccessBits(t *testing.T) {
+	// transport configuration: FF 07 80
+	access := [4]AccessBits{ACCESS_DATA_ANY, ACCESS_DATA_ANY, ACCESS_DATA_ANY, ACCESS_TRAILER_TRANSPORT}
+	b := EncodeAccessBits(access)
+	if b != [3]byte{0xFF, 0x07, 0x80} {
+		t.Errorf("EncodeAccessBits(transport) = % x, want ff 07 80", b)
+	}
+	access = [4]AccessBits{ACCESS_DATA_VALUE, ACCESS_DATA_B_ONLY, ACCESS_DATA_NEVER, ACCESS_TRAILER_B_WRITE}
+	b = EncodeAccessBits(access)
+	got, err := DecodeAccessBits(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != access {
+		t.Errorf("DecodeAccessBits = %v, want %v", got, access)
+	}
+	b[0] ^= 0x01
+	if _, err := DecodeAccessBits(b[:]); err != ErrBadTrail {
+		t.Errorf("DecodeAccessBits(corrupted) error = %v, want %v", err, ErrBadTrail)
+	}
+}
+
+func TestWriteSectorTrailer(t *testing.T) {
+	b := i2cemu.NewBus()
+	rf := newCardEmu([]byte{1, 2, 3, 4}, 0x0004)
+	b.Attach(I2CAddr, rf)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailer := &SectorTrailer{KeyA: DefaultKey, KeyB: DefaultKey}
+	trailer.Access[3] = 0x09
+	if err := m.WriteSectorTrailer(1, trailer); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("WriteSectorTrailer(access 0x09) = %v, want %v", err, deverr.ErrParameter)
+	}
+	trailer.Access[3] = ACCESS_TRAILER_TRANSPORT
+	if err := m.WriteSectorTrailer(40, trailer); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("WriteSectorTrailer(sector 40) = %v, want %v", err, deverr.ErrParameter)
+	}
+}
+
+func TestValueBlock(t *testing.T) {
+	b := EncodeValueBlock(-1234, 5)
+	v, a, err := DecodeValueBlock(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != -1234 || a != 5 {
+		t.Errorf("DecodeValueBlock = %d, %d, want -1234, 5", v, a)
+	}
+	b[4] ^= 0xFF
+	if _, _, err := DecodeValueBlock(b[:]); err != ErrBadValue {
+		t.Errorf("DecodeValueBlock(corrupted) error = %v, want %v", err, ErrBadValue)
+	}
+}
+
+func TestSectorBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		sector  int
+		first   uint8
+		trailer uint8
+	}{{0, 0, 3}, {15, 60, 63}, {31, 124, 127}, {32, 128, 143}, {39, 240, 255}} {
+		if f := SectorFirstBlock(tc.sector); f != tc.first {
+			t.Errorf("SectorFirstBlock(%d) = %d, want %d", tc.sector, f, tc.first)
+		}
+		if tr := SectorTrailerBlock(tc.sector); tr != tc.trailer {
+			t.Errorf("SectorTrailerBlock(%d) = %d, want %d", tc.sector, tr, tc.trailer)
+		}
+		if s := BlockSector(tc.trailer); s != tc.sector {
+			t.Errorf("BlockSector(%d) = %d, want %d", tc.trailer, s, tc.sector)
+		}
+	}
+}
+
+func TestNdefURI(t *testing.T) {
+	msg, err := EncodeNdefMessage(&URIRecord{URI: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{0xD1, 0x01, 0x0C, 'U', 0x04}, "example.com"...)
+	if !bytes.Equal(msg, want) {
+		t.Errorf("EncodeNdefMessage = % x, want % x", msg, want)
+	}
+	records, err := DecodeNdefMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	u, ok := records[0].(*URIRecord)
+	if !ok || u.URI != "https://example.com" {
+		t.Errorf("got %#v, want URI https://example.com", records[0])
+	}
+}
+
+func TestNdefMessage(t *testing.T) {
+	long := bytes.Repeat([]byte{0x5A}, 300)
+	in := []NdefRecord{
+		&TextRecord{Lang: "en", Text: "bin 42"},
+		&MIMERecord{Type: "application/octet-stream", Data: long},
+		&RawRecord{TNF: TNF_EXTERNAL, Type: []byte("example.com:bin"), ID: []byte("1"), Payload: []byte{1, 2}},
+	}
+	msg, err := EncodeNdefMessage(in...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlv := EncodeNdefTLV(msg)
+	// lock control TLV and NULL padding before the NDEF TLV
+	mem := append([]byte{TLV_LOCK_CTRL, 3, 0xA0, 0x10, 0x44, TLV_NULL}, tlv...)
+	if _, err := FindNdefTLV(mem[:len(mem)/2]); err != ErrNdefTruncated {
+		t.Errorf("FindNdefTLV(half) error = %v, want %v", err, ErrNdefTruncated)
+	}
+	found, err := FindNdefTLV(mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecodeNdefMessage(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("got %d records, want %d", len(out), len(in))
+	}
+	if txt, ok := out[0].(*TextRecord); !ok || *txt != *in[0].(*TextRecord) {
+		t.Errorf("record 0 = %#v, want %#v", out[0], in[0])
+	}
+	if m, ok := out[1].(*MIMERecord); !ok || m.Type != "application/octet-stream" || !bytes.Equal(m.Data, long) {
+		t.Errorf("record 1 = %#v, want MIME record", out[1])
+	}
+	if r, ok := out[2].(*RawRecord); !ok || r.TNF != TNF_EXTERNAL || string(r.ID) != "1" || !bytes.Equal(r.Payload, []byte{1, 2}) {
+		t.Errorf("record 2 = %#v, want external record", out[2])
+	}
+}
+
+func TestTagVersion(t *testing.T) {
+	v := TagVersion{Header: 0x00, Vendor: 0x04, ProductType: 0x04, SubType: 0x02, Major: 0x01, StorageSize: 0x0F, Protocol: 0x03}
+	if tt := v.TagType(); tt != TAG_NTAG213 {
+		t.Errorf("TagType = %v, want %v", tt, TAG_NTAG213)
+	}
+	info, _ := TAG_NTAG213.Info()
+	if info.UserMemoryLen != 144 {
+		t.Errorf("NTAG213 user memory = %d, want 144", info.UserMemoryLen)
+	}
+}
+
+func TestPresenceDebounce(t *testing.T) {
+	p := presence{debounce: 2}
+	a := &Card{UID: []byte{1, 2, 3, 4}, ATQA: 0x0004, SAK: 0x08}
+	b := &Card{UID: []byte{5, 6, 7, 8}, ATQA: 0x0044, SAK: 0x00}
+	now := time.Now()
+	steps := []struct {
+		card *Card
+		want []EventType
+	}{
+		{nil, nil},
+		{a, []EventType{CARD_ARRIVED}},
+		{a, nil},
+		{nil, nil}, // single miss is debounced
+		{a, nil},
+		{nil, nil},
+		{nil, []EventType{CARD_REMOVED}},
+		{nil, nil},
+		{a, []EventType{CARD_ARRIVED}},
+		{b, []EventType{CARD_REMOVED, CARD_ARRIVED}},
+	}
+	for i, s := range steps {
+		events := p.update(s.card, now)
+		if len(events) != len(s.want) {
+			t.Fatalf("step %d: got %v, want %v", i, events, s.want)
+		}
+		for j, e := range events {
+			if e.Type != s.want[j] {
+				t.Errorf("step %d: event %d is %v, want %v", i, j, e.Type, s.want[j])
+			}
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	b := i2cemu.NewBus()
+	uid := []byte{1, 2, 3, 4}
+	rf := newCardEmu(uid, 0x0004)
+	b.Attach(I2CAddr, rf)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Period is invalid and falls back to the default
+	events := m.Watch(ctx, &WatchOpts{Debounce: 1})
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+		return Event{}
+	}
+
+	if e := next(); e.Type != CARD_ARRIVED || !bytes.Equal(e.Card.UID, uid) {
+		t.Fatalf("got %v %v, want card arrived", e.Type, e.Card)
+	}
+	// bus faults are reported, the card is not removed
+	rf.SetError(errors.New("bus fault"))
+	for i := 0; i < 3; i++ {
+		if e := next(); e.Type != WATCH_ERROR || !errors.Is(e.Err, deverr.ErrBus) {
+			t.Fatalf("got %v %v, want a bus error", e.Type, e.Err)
+		}
+	}
+	rf.SetError(nil)
+	timeout := time.After(3 * DefaultWatchOpts.Period)
+	for done := false; !done; {
+		select {
+		case e := <-events:
+			// an error may still come from a poll before the fault was cleared
+			if e.Type != WATCH_ERROR {
+				t.Errorf("got %v after the bus recovered, want no event", e.Type)
+			}
+		case <-timeout:
+			done = true
+		}
+	}
+	cancel()
+	for range events {
+	}
+}
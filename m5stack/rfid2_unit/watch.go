@@ -0,0 +1,159 @@
+package rfid2_unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"devices/deverr"
+)
+
+// EventType tells what happened to the card in the field.
+type EventType int
+
+const (
+	CARD_ARRIVED EventType = iota
+	CARD_REMOVED
+	WATCH_ERROR // the reader could not be polled, the card is kept
+)
+
+func (t EventType) String() string {
+	switch t {
+	case CARD_ARRIVED:
+		return "arrived"
+	case CARD_REMOVED:
+		return "removed"
+	}
+	return "error"
+}
+
+// Event is sent by Watch when a card enters or leaves the field, or when
+// polling fails.
+type Event struct {
+	Type EventType
+	Card Card
+	Time time.Time
+	Err  error // WATCH_ERROR only
+}
+
+// WatchOpts holds the polling options.
+type WatchOpts struct {
+	Period   time.Duration // time between two polls
+	Debounce int           // consecutive missed polls before a card is reported removed
+}
+
+// DefaultWatchOpts are the recommended default polling options.
+var DefaultWatchOpts = WatchOpts{
+	Period:   100 * time.Millisecond,
+	Debounce: 3,
+}
+
+// presence tracks the card in the field and debounces its removal.
+type presence struct {
+	card     *Card
+	misses   int
+	debounce int
+}
+
+func (p *presence) update(card *Card, now time.Time) []Event {
+	var events []Event
+	if card == nil {
+		if p.card == nil {
+			return nil
+		}
+		p.misses++
+		if p.misses < p.debounce {
+			return nil
+		}
+		events = append(events, Event{Type: CARD_REMOVED, Card: *p.card, Time: now})
+		p.card = nil
+		return events
+	}
+	p.misses = 0
+	if p.card != nil && bytes.Equal(p.card.UID, card.UID) {
+		return nil
+	}
+	if p.card != nil {
+		events = append(events, Event{Type: CARD_REMOVED, Card: *p.card, Time: now})
+	}
+	p.card = card
+	return append(events, Event{Type: CARD_ARRIVED, Card: *card, Time: now})
+}
+
+// readerFault tells bus and reader errors from the PICC not answering.
+func readerFault(err error) bool {
+	return errors.Is(err, deverr.ErrBus) || errors.Is(err, deverr.ErrDevice)
+}
+
+// poll wakes up any card in the field, selects it and halts it again
+// so that the next poll sees the same card. It returns a nil card when no
+// card answers and an error when the reader cannot be accessed.
+func (h *Dev) poll() (*Card, error) {
+	atqa, err := h.WakeupA()
+	if err != nil {
+		if readerFault(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	uid, sak, err := h.Select()
+	if err != nil {
+		if readerFault(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if err := h.HaltA(); readerFault(err) {
+		return nil, err
+	}
+	return &Card{UID: uid, ATQA: atqa, SAK: sak}, nil
+}
+
+// Watch polls the field until ctx is done and reports cards arriving and leaving.
+// A card staying on the antenna is reported once. The channel is closed when ctx is done.
+// A failed poll is reported as a WATCH_ERROR event and does not count as a
+// missed poll. A nil opts, a Period <= 0 or a Debounce < 1 fall back to
+// DefaultWatchOpts.
+// The device must not be used by other goroutines while watching.
+func (h *Dev) Watch(ctx context.Context, opts *WatchOpts) <-chan Event {
+	o := DefaultWatchOpts
+	if opts != nil {
+		o = *opts
+	}
+	if o.Period <= 0 {
+		o.Period = DefaultWatchOpts.Period
+	}
+	if o.Debounce < 1 {
+		o.Debounce = DefaultWatchOpts.Debounce
+	}
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		p := presence{debounce: o.Debounce}
+		ticker := time.NewTicker(o.Period)
+		defer ticker.Stop()
+		for {
+			var events []Event
+			card, err := h.poll()
+			if err != nil {
+				events = []Event{{Type: WATCH_ERROR, Time: time.Now(), Err: err}}
+			} else {
+				events = p.update(card, time.Now())
+			}
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -1 +1,77 @@
 package servo_unit
+
+import (
+	"errors"
+	"testing"
+
+	"devices/deverr"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+)
+
+func TestDev_emu(t *testing.T) {
+	b := i2cemu.NewBus()
+	rf := i2cemu.NewRegisterFile()
+	rf.Set(M5_UNIT_8SERVO_ANALOG_INPUT_12B_REG+2, 0x34, 0x0A)
+	rf.Set(FIRMWARE_VERSION_REG, 3)
+	b.Attach(I2CAddr, rf)
+
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetAllPinMode(SERVO_CTL_MODE); err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := m.GetOnePinMode(7); err != nil || mode != SERVO_CTL_MODE {
+		t.Errorf("GetOnePinMode(7) = %d, %v", mode, err)
+	}
+	m.SetServoPulse(2, 1500)
+	if got := rf.Get(M5_UNIT_8SERVO_SERVO_PULSE_16B_REG+4, 2); got[0] != 0xDC || got[1] != 0x05 {
+		t.Errorf("servo 2 pulse = %v, want 1500", got)
+	}
+	m.SetLEDColor(1, 0x102030)
+	if got := rf.Get(M5_UNIT_8SERVO_RGB_24B_REG+3, 3); got[0] != 0x10 || got[1] != 0x20 || got[2] != 0x30 {
+		t.Errorf("led 1 = %v", got)
+	}
+	if v, err := m.GetAnalogInput(1, A12bit); err != nil || v != 0x0A34 {
+		t.Errorf("GetAnalogInput(1) = 0x%04x, %v", v, err)
+	}
+	if v, err := m.GetFirmwareVersion(); err != nil || v != 3 {
+		t.Errorf("GetFirmwareVersion() = %d, %v", v, err)
+	}
+	rf.Set(M5_UNIT_8SERVO_DIGITAL_INPUT_REG+4, 1)
+	if v, err := m.GetDigitalInput(4); err != nil || !v {
+		t.Errorf("GetDigitalInput(4) = %t, %v", v, err)
+	}
+	if err := m.SetOnePinMode(9, PWM_MODE); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("SetOnePinMode(9) = %v", err)
+	}
+	rf.SetError(errors.New("remote I/O error"))
+	if _, err := m.GetDigitalInput(4); !errors.Is(err, deverr.ErrBus) {
+		t.Errorf("GetDigitalInput() on a failing bus = %v", err)
+	}
+	if _, err := m.GetAnalogInput(1, A12bit); !errors.Is(err, deverr.ErrBus) {
+		t.Errorf("GetAnalogInput() on a failing bus = %v", err)
+	}
+}
+
+func TestDev_SetI2CAddress(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewServoUnit(3)
+	s.Attach(b, I2CAddr)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetI2CAddress(0x26); err != nil {
+		t.Fatal(err)
+	}
+	// the address register is written, not the bootloader jump
+	if s.Addr() != 0x26 || s.Get(JUMP_TO_BOOTLOADER_REG, 1)[0] != 0 {
+		t.Errorf("unit at 0x%02x", s.Addr())
+	}
+	if a, err := m.GetI2CAddress(); err != nil || a != 0x26 {
+		t.Errorf("GetI2CAddress() = 0x%02x, %v", a, err)
+	}
+}
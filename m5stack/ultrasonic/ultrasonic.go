@@ -1,15 +1,19 @@
 package ultrasonic
 
 import (
-	"fmt"
 	"time"
 
+	"devices/deverr"
+
 	"periph.io/x/conn/v3/i2c"
 )
 
 // I2CAddr is the default I2C address for the m5stack ultrasnic.
 const I2CAddr uint16 = 0x57
 
+// MAX_DISTANCE is the range of the sensor in mm.
+const MAX_DISTANCE = 4500.0
+
 // Opts holds the configuration options.
 type Opts struct {
 	I2cAddress uint16
@@ -28,7 +32,7 @@ type Dev struct {
 // New creates a new driver for CCS811 VOC sensor.
 func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
 	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x70 {
-		return nil, fmt.Errorf("invalid device address")
+		return nil, deverr.Paramf("invalid device address")
 	}
 
 	return &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}, nil
@@ -38,23 +42,25 @@ func (dev *Dev) Close() {
 
 }
 
-func (dev *Dev) GetDistance() float64 {
+// GetDistance triggers a measurement and returns the distance in mm, up to
+// MAX_DISTANCE.
+func (dev *Dev) GetDistance() (float64, error) {
 	b := make([]byte, 1)
 	b[0] = 1
 	_, err := dev.c.Write(b)
 	if err != nil {
-		return -1
+		return 0, deverr.Bus(dev.c.Addr, "trigger measurement", err)
 	}
 	r := make([]byte, 3)
 	time.Sleep(20 * time.Millisecond)
 	err = dev.c.Tx(nil, r)
 	if err != nil {
-		return -1
+		return 0, deverr.Bus(dev.c.Addr, "read distance", err)
 	}
 	d := float64(uint32(r[0])<<16+uint32(r[1])<<8+uint32(r[2])) / 1000
-	if d > 4500.0 {
-		return 4500.0
+	if d > MAX_DISTANCE {
+		return MAX_DISTANCE, nil
 	}
 
-	return d
+	return d, nil
 }
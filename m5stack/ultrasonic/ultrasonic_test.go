@@ -1,25 +1,31 @@
 package ultrasonic
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"testing"
 	"time"
 
+	"devices/deverr"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+
 	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
 	"periph.io/x/host/v3"
 )
 
 func TestDev_MotorMovement(t *testing.T) {
 	// Make sure periph is initialized.
 	if _, err := host.Init(); err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 
 	// Use i2creg I²C bus registry to find the first available I²C bus.
 	b, err := i2creg.Open("")
 	if err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 	defer b.Close()
 
@@ -29,10 +35,49 @@ func TestDev_MotorMovement(t *testing.T) {
 	}
 
 	for i := 0; i <= 20; i++ {
-		fmt.Printf("Distance: %.2f\n", s.GetDistance())
+		d, err := s.GetDistance()
+		fmt.Printf("Distance: %.2f %v\n", d, err)
 		time.Sleep(2 * time.Second)
 	}
 
 	s.Close()
 
 }
+
+func TestDev_emu(t *testing.T) {
+	b := i2cemu.NewBus()
+	triggered := false
+	b.Attach(I2CAddr, i2cemu.DeviceFunc(func(w, r []byte) error {
+		if len(w) == 1 && w[0] == 1 {
+			triggered = true
+		}
+		if len(r) == 3 && triggered {
+			// 123.456mm in µm
+			copy(r, []byte{0x01, 0xE2, 0x40})
+		}
+		return nil
+	}))
+	s, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := s.GetDistance(); err != nil || d != 123.456 {
+		t.Errorf("GetDistance() = %f, %v, want 123.456", d, err)
+	}
+	b.Detach(I2CAddr)
+	if _, err := s.GetDistance(); !errors.Is(err, deverr.ErrBus) {
+		t.Errorf("GetDistance() without device = %v, want %v", err, deverr.ErrBus)
+	}
+}
+
+func TestDev_sim(t *testing.T) {
+	b := i2cemu.NewBus()
+	b.Attach(I2CAddr, sim.NewRCWL9620(250*physic.MilliMetre))
+	s, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := s.GetDistance(); err != nil || d != 250 {
+		t.Errorf("GetDistance() = %f, %v, want 250", d, err)
+	}
+}
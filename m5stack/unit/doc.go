@@ -0,0 +1,9 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package unit holds the registers shared by the STM32 based M5Stack units:
+// firmware version (0xFE), I²C address (0xFF) and bootloader jump (0xFD).
+//
+// Unit is embedded by the unit drivers, it provides the register access and
+// the operations on these registers.
+package unit
@@ -0,0 +1,161 @@
+package unit
+
+import (
+	"fmt"
+	"time"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+const (
+	JUMP_TO_BOOTLOADER_REG = 0xFD
+	FW_VERSION_REG         = 0xFE
+	I2C_ADDRESS_REG        = 0xFF
+
+	// addresses accepted by SetI2CAddress and by the unit drivers
+	MIN_ADDR = 0x08
+	MAX_ADDR = 0x77
+)
+
+// ProbeTimeout is how long SetI2CAddress waits for the unit at its new address.
+var ProbeTimeout = 500 * time.Millisecond
+
+// Info identifies a unit.
+type Info struct {
+	Addr            uint16
+	FirmwareVersion uint8
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("M5Stack unit at 0x%02x, firmware %d", i.Addr, i.FirmwareVersion)
+}
+
+// Unit is an handle to the common registers of an M5Stack unit.
+type Unit struct {
+	c i2c.Dev
+}
+
+// New returns the unit at addr, it does not access the bus.
+func New(bus i2c.Bus, addr uint16) *Unit {
+	return &Unit{c: i2c.Dev{Bus: bus, Addr: addr}}
+}
+
+// Addr returns the address used to access the unit.
+func (u *Unit) Addr() uint16 {
+	return u.c.Addr
+}
+
+// ReadBytes reads size registers from reg.
+func (u *Unit) ReadBytes(reg int, size int) ([]uint8, error) {
+	r := make([]byte, size)
+	err := u.c.Tx([]byte{byte(reg)}, r)
+	if err != nil {
+		return r, deverr.Bus(u.c.Addr, fmt.Sprintf("read register 0x%02x", reg), err)
+	}
+	return r, nil
+}
+
+// WriteBytes writes data to the registers from reg.
+func (u *Unit) WriteBytes(reg int, data []uint8) error {
+	d := []byte{byte(reg)}
+	d = append(d, data...)
+	if err := u.c.Tx(d, nil); err != nil {
+		return deverr.Bus(u.c.Addr, fmt.Sprintf("write register 0x%02x", reg), err)
+	}
+	return nil
+}
+
+func (u *Unit) GetFirmwareVersion() (uint8, error) {
+	data, err := u.ReadBytes(FW_VERSION_REG, 1)
+	if err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+func (u *Unit) GetI2CAddress() (uint8, error) {
+	data, err := u.ReadBytes(I2C_ADDRESS_REG, 1)
+	if err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+// JumpBootloader starts the bootloader of the unit, its protocol is not
+// documented, see cmd/m5flash.
+func (u *Unit) JumpBootloader() error {
+	return u.WriteBytes(JUMP_TO_BOOTLOADER_REG, []uint8{1})
+}
+
+// Identify reads the identification of the unit, see Probe.
+func (u *Unit) Identify() (Info, error) {
+	return Probe(u.c.Bus, u.c.Addr)
+}
+
+// Probe identifies the M5Stack unit at addr: the unit reports its own address
+// in its address register.
+func Probe(bus i2c.Bus, addr uint16) (Info, error) {
+	u := New(bus, addr)
+	a, err := u.GetI2CAddress()
+	if err != nil {
+		return Info{}, deverr.NotDetected(addr, err)
+	}
+	if uint16(a) != addr {
+		return Info{}, deverr.NotDetected(addr, fmt.Errorf("address register 0x%02x", a))
+	}
+	fw, err := u.GetFirmwareVersion()
+	if err != nil {
+		return Info{}, deverr.NotDetected(addr, err)
+	}
+	return Info{Addr: addr, FirmwareVersion: fw}, nil
+}
+
+// SetI2CAddress moves the unit to addr, from 0x08 to 0x77, the new address is
+// used at once and kept across power cycles. The address must be free, the
+// firmware version is read again at addr to check the move before the unit
+// is accessed there. It must not be called while the unit is used by another
+// goroutine.
+func (u *Unit) SetI2CAddress(addr uint8) error {
+	return u.SetI2CAddressTimeout(addr, ProbeTimeout)
+}
+
+// SetI2CAddressTimeout is SetI2CAddress waiting up to timeout for the unit at
+// its new address.
+func (u *Unit) SetI2CAddressTimeout(addr uint8, timeout time.Duration) error {
+	if addr < MIN_ADDR || addr > MAX_ADDR {
+		return deverr.Paramf("address out of range (0x%02x..0x%02x)", MIN_ADDR, MAX_ADDR)
+	}
+	if uint16(addr) == u.c.Addr {
+		return nil
+	}
+	if err := u.c.Bus.Tx(uint16(addr), nil, make([]byte, 1)); err == nil {
+		return deverr.Paramf("another device answers at 0x%02x", addr)
+	}
+	fw, err := u.GetFirmwareVersion()
+	if err != nil {
+		return err
+	}
+	if err := u.WriteBytes(I2C_ADDRESS_REG, []uint8{addr}); err != nil {
+		return err
+	}
+
+	moved := New(u.c.Bus, uint16(addr))
+	deadline := time.Now().Add(timeout)
+	for {
+		v, err := moved.GetFirmwareVersion()
+		if err == nil && v == fw {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("firmware version %d, want %d", v, fw)
+			}
+			return deverr.NotDetected(uint16(addr), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	u.c.Addr = uint16(addr)
+	return nil
+}
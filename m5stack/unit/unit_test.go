@@ -0,0 +1,48 @@
+package unit
+
+import (
+	"errors"
+	"testing"
+
+	"devices/deverr"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+)
+
+func TestUnit(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewServoUnit(3)
+	s.Attach(b, 0x25)
+
+	if _, err := Probe(b, 0x26); !errors.Is(err, deverr.ErrNotDetected) {
+		t.Errorf("Probe() of an empty address = %v", err)
+	}
+	// a register device that does not report its address
+	b.Attach(0x30, i2cemu.NewRegisterFile())
+	if _, err := Probe(b, 0x30); !errors.Is(err, deverr.ErrNotDetected) {
+		t.Errorf("Probe() of another device = %v", err)
+	}
+
+	u := New(b, 0x25)
+	if i, err := u.Identify(); err != nil || i != (Info{Addr: 0x25, FirmwareVersion: 3}) {
+		t.Errorf("Identify() = %s, %v", i, err)
+	}
+	if err := u.SetI2CAddress(0x30); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("SetI2CAddress() to a used address = %v", err)
+	}
+	if err := u.SetI2CAddress(0x07); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("SetI2CAddress(0x07) = %v", err)
+	}
+	if err := u.SetI2CAddress(0x26); err != nil {
+		t.Fatal(err)
+	}
+	if u.Addr() != 0x26 || s.Addr() != 0x26 {
+		t.Errorf("unit at 0x%02x, Addr() = 0x%02x", s.Addr(), u.Addr())
+	}
+	if i, err := Probe(b, 0x26); err != nil || i.FirmwareVersion != 3 {
+		t.Errorf("Probe() after the move = %s, %v", i, err)
+	}
+	if err := u.JumpBootloader(); err != nil || s.Get(JUMP_TO_BOOTLOADER_REG, 1)[0] != 1 {
+		t.Errorf("JumpBootloader() = %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package motor defines a common interface for the DC motor drivers of this
+// module, so that drivetrain code does not depend on a particular board.
+//
+// Adapters are provided for drf0592, ws15364 and m5stack/hbridge.
+package motor
@@ -0,0 +1,142 @@
+package motor
+
+import (
+	"math"
+
+	"devices/deverr"
+	"devices/drf0592"
+	"devices/m5stack/hbridge"
+	"devices/ws15364"
+)
+
+// ErrNotSupported is returned when the board cannot perform the operation.
+var ErrNotSupported = deverr.ErrNotSupported
+
+// Motor is a DC motor channel.
+type Motor interface {
+	// SetSpeed sets the signed speed as a fraction of full power,
+	// from -1.0 (full reverse) to 1.0 (full forward).
+	SetSpeed(speed float32) error
+	// Brake shorts the motor windings.
+	Brake() error
+	// Coast releases the motor windings.
+	Coast() error
+	// Stop stops the motor the way the board does by default.
+	Stop() error
+}
+
+func checkSpeed(speed float32) error {
+	if speed < -1.0 || speed > 1.0 || math.IsNaN(float64(speed)) {
+		return deverr.Paramf("speed out of range: -1.0-1.0")
+	}
+	return nil
+}
+
+func abs(speed float32) float32 {
+	if speed < 0 {
+		return -speed
+	}
+	return speed
+}
+
+// DRF0592 drives one motor of a DFRobot DC Motor Driver HAT.
+// The board has no brake mode.
+type DRF0592 struct {
+	dev *drf0592.Dev
+	id  drf0592.MotorId
+}
+
+// NewDRF0592 returns the Motor interface of motor id of dev.
+func NewDRF0592(dev *drf0592.Dev, id drf0592.MotorId) *DRF0592 {
+	return &DRF0592{dev: dev, id: id}
+}
+
+// SetSpeed sets the duty cycle, negative speeds turn counterclockwise.
+func (m *DRF0592) SetSpeed(speed float32) error {
+	if err := checkSpeed(speed); err != nil {
+		return err
+	}
+	dir := drf0592.CW
+	if speed < 0 {
+		dir = drf0592.CCW
+	}
+	return m.dev.MotorMovement(m.id, dir, abs(speed)*100.0)
+}
+
+// Brake returns ErrNotSupported.
+func (m *DRF0592) Brake() error {
+	return ErrNotSupported
+}
+
+// Coast stops the motor, the board only coasts.
+func (m *DRF0592) Coast() error {
+	return m.dev.MotorStop(m.id)
+}
+
+// Stop stops the motor, like Coast.
+func (m *DRF0592) Stop() error {
+	return m.dev.MotorStop(m.id)
+}
+
+// WS15364 drives one motor of a Waveshare Motor Driver HAT.
+type WS15364 struct {
+	dev *ws15364.Dev
+	id  ws15364.MotorId
+}
+
+// NewWS15364 returns the Motor interface of motor id of dev.
+func NewWS15364(dev *ws15364.Dev, id ws15364.MotorId) *WS15364 {
+	return &WS15364{dev: dev, id: id}
+}
+
+// SetSpeed brakes before a change of direction, a zero speed brakes.
+func (m *WS15364) SetSpeed(speed float32) error {
+	if err := checkSpeed(speed); err != nil {
+		return err
+	}
+	return m.dev.SetSpeed(m.id, speed*100.0)
+}
+
+// Brake sets both TB6612 inputs high, the outputs are shorted.
+func (m *WS15364) Brake() error {
+	return m.dev.Brake(m.id)
+}
+
+// Coast sets both TB6612 inputs low, the outputs are in high impedance.
+func (m *WS15364) Coast() error {
+	return m.dev.Coast(m.id)
+}
+
+func (m *WS15364) Stop() error {
+	return m.dev.MotorStop(m.id)
+}
+
+// HBridge drives the motor of a M5Stack H-bridge unit.
+// The stop behaviour is defined by the unit firmware, brake and coast are not selectable.
+type HBridge struct {
+	dev *hbridge.Dev
+}
+
+// NewHBridge returns the Motor interface of dev.
+func NewHBridge(dev *hbridge.Dev) *HBridge {
+	return &HBridge{dev: dev}
+}
+
+func (m *HBridge) SetSpeed(speed float32) error {
+	if err := checkSpeed(speed); err != nil {
+		return err
+	}
+	return m.dev.SetVelocity(int32(speed * hbridge.MAX_VELOCITY))
+}
+
+func (m *HBridge) Brake() error {
+	return ErrNotSupported
+}
+
+func (m *HBridge) Coast() error {
+	return ErrNotSupported
+}
+
+func (m *HBridge) Stop() error {
+	return m.dev.SetDriverDirection(hbridge.HBRIDGE_STOP)
+}
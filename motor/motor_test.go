@@ -0,0 +1,111 @@
+package motor
+
+import (
+	"bytes"
+	"testing"
+
+	"devices/drf0592"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+	"devices/m5stack/hbridge"
+	"devices/ws15364"
+
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+// Check that all adapters implement Motor.
+var (
+	_ Motor = &DRF0592{}
+	_ Motor = &WS15364{}
+	_ Motor = &HBridge{}
+)
+
+func TestDRF0592(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewDFR0592()
+	s.Attach(b, drf0592.I2CAddr)
+	dev, err := drf0592.New(b, &drf0592.DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewDRF0592(dev, drf0592.M2)
+	// the motor speed follows the duty cycle, negative counterclockwise
+	if err := m.SetSpeed(-0.5); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.MotorSpeed(2); v != -0.5*s.NoLoadRPM || s.MotorSpeed(1) != 0 {
+		t.Errorf("SetSpeed(-0.5): M1 %grpm M2 %grpm", s.MotorSpeed(1), v)
+	}
+	if err := m.SetSpeed(0.255); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.MotorSpeed(2); v != 0.255*s.NoLoadRPM {
+		t.Errorf("SetSpeed(0.255): M2 %grpm", v)
+	}
+	if err := m.SetSpeed(-1.5); err == nil {
+		t.Errorf("SetSpeed(-1.5) succeeded")
+	}
+	if err := m.Brake(); err != ErrNotSupported {
+		t.Errorf("Brake() = %v, want %v", err, ErrNotSupported)
+	}
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if v := s.MotorSpeed(2); v != 0 {
+		t.Errorf("Stop(): M2 %grpm", v)
+	}
+}
+
+func TestHBridge(t *testing.T) {
+	bus := &i2ctest.Record{}
+	dev, err := hbridge.New(bus, &hbridge.DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewHBridge(dev)
+	bus.Ops = nil
+	if err := m.SetSpeed(-0.5); err != nil {
+		t.Fatal(err)
+	}
+	want := []i2ctest.IO{
+		{Addr: hbridge.I2CAddr, W: []byte{hbridge.HBRIDGE_CONFIG_REG, byte(hbridge.HBRIDGE_BACKWARD), 0x7F, 0xFF, 0x7F}},
+	}
+	if len(bus.Ops) != len(want) {
+		t.Fatalf("got %d transactions, want %d", len(bus.Ops), len(want))
+	}
+	for i := range want {
+		if bus.Ops[i].Addr != want[i].Addr || !bytes.Equal(bus.Ops[i].W, want[i].W) {
+			t.Errorf("transaction %d = %#v, want %#v", i, bus.Ops[i], want[i])
+		}
+	}
+	if err := m.SetSpeed(1.5); err == nil {
+		t.Errorf("SetSpeed(1.5) succeeded")
+	}
+	if err := m.Brake(); err != ErrNotSupported {
+		t.Errorf("Brake() = %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestWS15364(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewPCA9685()
+	b.Attach(ws15364.I2CAddr, s)
+	dev, err := ws15364.New(b, &ws15364.DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewWS15364(dev, ws15364.M2)
+	if err := m.SetSpeed(-0.5); err != nil {
+		t.Fatal(err)
+	}
+	// M2 uses PWMB on channel 5, BIN1 and BIN2 on channels 3 and 4
+	if s.Duty(5) != 0.5 || s.Duty(3) != 1 || s.Duty(4) != 0 {
+		t.Errorf("SetSpeed(-0.5): PWMB %f BIN1 %f BIN2 %f", s.Duty(5), s.Duty(3), s.Duty(4))
+	}
+	if err := m.Brake(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Duty(3) != 1 || s.Duty(4) != 1 {
+		t.Errorf("Brake(): BIN1 %f BIN2 %f, want both on", s.Duty(3), s.Duty(4))
+	}
+}
@@ -0,0 +1,16 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package stm32boot flashes STM32 microcontrollers over I²C with the STM32
+// I²C bootloader protocol described in ST application note AN4221: Get, Get
+// ID, Read Memory, Write Memory, Extended Erase and Go.
+//
+// The bootloader is the one in system memory of the STM32 which have one, or
+// a bootloader stored in flash speaking the same protocol. The bootloader
+// address and the application address must be given in Opts, BootSize keeps
+// a bootloader stored at the start of the flash: New refuses an application
+// over it. Only the pages covering the image are erased, mass erase is never
+// used.
+//
+// AN4221: https://www.st.com/resource/en/application_note/an4221-i2c-protocol-used-in-the-stm32-bootloader-stmicroelectronics.pdf
+package stm32boot
@@ -0,0 +1,346 @@
+package stm32boot
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/i2c"
+)
+
+const (
+	_ACK  = 0x79
+	_NACK = 0x1F
+	_BUSY = 0x76
+
+	_CMD_GET            = 0x00
+	_CMD_GET_ID         = 0x02
+	_CMD_READ_MEMORY    = 0x11
+	_CMD_GO             = 0x21
+	_CMD_WRITE_MEMORY   = 0x31
+	_CMD_EXTENDED_ERASE = 0x44
+
+	// FLASH_BASE is the address of the STM32 flash memory.
+	FLASH_BASE = 0x08000000
+	// MAX_CHUNK is the largest read or write of the protocol.
+	MAX_CHUNK = 256
+)
+
+// AckTimeout is how long an operation waits for the bootloader, erasing a
+// page takes up to 40ms on the STM32F0.
+var AckTimeout = time.Second
+
+// Opts holds the configuration options.
+type Opts struct {
+	I2cAddress uint16 // address of the bootloader
+	AppAddress uint32 // start of the application in flash, page aligned, required
+	PageSize   int    // flash page size in bytes
+	BootSize   int    // bytes at the start of the flash holding a bootloader, kept
+}
+
+// DefaultOpts are the STM32F030 flash page size without a bootloader in
+// flash, the bootloader address and the application address must be set.
+var DefaultOpts = Opts{
+	PageSize: 1024,
+}
+
+// Stage is a step of Flash.
+type Stage int
+
+const (
+	STAGE_ERASE Stage = iota
+	STAGE_WRITE
+	STAGE_VERIFY
+	STAGE_START
+)
+
+func (s Stage) String() string {
+	switch s {
+	case STAGE_ERASE:
+		return "erase"
+	case STAGE_WRITE:
+		return "write"
+	case STAGE_VERIFY:
+		return "verify"
+	case STAGE_START:
+		return "start"
+	}
+	return fmt.Sprintf("Stage(%d)", int(s))
+}
+
+// Progress reports the progress of Flash, Done and Total are in bytes.
+type Progress struct {
+	Stage Stage
+	Done  int
+	Total int
+}
+
+// Dev is an handle to the bootloader of an STM32.
+type Dev struct {
+	c       i2c.Dev
+	opts    Opts
+	version byte
+	pid     uint16
+}
+
+// New connects to the bootloader and reads its version and product ID.
+func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
+	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x7F {
+		return nil, deverr.Paramf("invalid device address")
+	}
+	if opts.PageSize <= 0 || opts.AppAddress < FLASH_BASE || (opts.AppAddress-FLASH_BASE)%uint32(opts.PageSize) != 0 {
+		return nil, deverr.Paramf("application address 0x%08x is not a page of the flash", opts.AppAddress)
+	}
+	if opts.BootSize < 0 || opts.AppAddress < FLASH_BASE+uint32(opts.BootSize) {
+		return nil, deverr.Paramf("application address 0x%08x overwrites the bootloader", opts.AppAddress)
+	}
+	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}, opts: *opts}
+	var err error
+	if dev.version, _, err = dev.Get(); err != nil {
+		return nil, deverr.NotDetected(opts.I2cAddress, err)
+	}
+	if dev.pid, err = dev.GetID(); err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
+
+// Version returns the protocol version read by New.
+func (dev *Dev) Version() byte {
+	return dev.version
+}
+
+// PID returns the product ID of the microcontroller read by New.
+func (dev *Dev) PID() uint16 {
+	return dev.pid
+}
+
+func (dev *Dev) write(op string, w []byte) error {
+	if err := dev.c.Tx(w, nil); err != nil {
+		return deverr.Bus(dev.c.Addr, op, err)
+	}
+	return nil
+}
+
+func (dev *Dev) read(op string, n int) ([]byte, error) {
+	r := make([]byte, n)
+	if err := dev.c.Tx(nil, r); err != nil {
+		return nil, deverr.Bus(dev.c.Addr, op, err)
+	}
+	return r, nil
+}
+
+// ack waits for the acknowledge of op, the bootloader answers busy while it
+// erases or writes.
+func (dev *Dev) ack(op string) error {
+	deadline := time.Now().Add(AckTimeout)
+	for {
+		r, err := dev.read(op, 1)
+		if err != nil {
+			return err
+		}
+		switch r[0] {
+		case _ACK:
+			return nil
+		case _NACK:
+			return fmt.Errorf("%w: %s refused by the bootloader", deverr.ErrDevice, op)
+		case _BUSY:
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%w: %s timed out", deverr.ErrDevice, op)
+			}
+			time.Sleep(time.Millisecond)
+		default:
+			return fmt.Errorf("%w: %s unexpected answer 0x%02x", deverr.ErrDevice, op, r[0])
+		}
+	}
+}
+
+// command sends cmd and its complement.
+func (dev *Dev) command(op string, cmd byte) error {
+	if err := dev.write(op, []byte{cmd, ^cmd}); err != nil {
+		return err
+	}
+	return dev.ack(op)
+}
+
+// frame sends data followed by its XOR checksum.
+func (dev *Dev) frame(op string, data []byte) error {
+	var x byte
+	for _, v := range data {
+		x ^= v
+	}
+	if err := dev.write(op, append(append([]byte(nil), data...), x)); err != nil {
+		return err
+	}
+	return dev.ack(op)
+}
+
+func (dev *Dev) address(op string, cmd byte, addr uint32) error {
+	if err := dev.command(op, cmd); err != nil {
+		return err
+	}
+	return dev.frame(op, []byte{byte(addr >> 24), byte(addr >> 16), byte(addr >> 8), byte(addr)})
+}
+
+// Get returns the protocol version and the supported commands.
+func (dev *Dev) Get() (byte, []byte, error) {
+	if err := dev.command("Get", _CMD_GET); err != nil {
+		return 0, nil, err
+	}
+	n, err := dev.read("Get", 1)
+	if err != nil {
+		return 0, nil, err
+	}
+	r, err := dev.read("Get", int(n[0])+1)
+	if err != nil {
+		return 0, nil, err
+	}
+	return r[0], r[1:], dev.ack("Get")
+}
+
+// GetID returns the product ID of the microcontroller.
+func (dev *Dev) GetID() (uint16, error) {
+	if err := dev.command("Get ID", _CMD_GET_ID); err != nil {
+		return 0, err
+	}
+	n, err := dev.read("Get ID", 1)
+	if err != nil {
+		return 0, err
+	}
+	r, err := dev.read("Get ID", int(n[0])+1)
+	if err != nil {
+		return 0, err
+	}
+	if len(r) != 2 {
+		return 0, fmt.Errorf("%w: Get ID returned %d bytes", deverr.ErrDevice, len(r))
+	}
+	return uint16(r[0])<<8 | uint16(r[1]), dev.ack("Get ID")
+}
+
+// ReadMemory reads len(b) bytes from addr.
+func (dev *Dev) ReadMemory(addr uint32, b []byte) error {
+	for len(b) > 0 {
+		n := len(b)
+		if n > MAX_CHUNK {
+			n = MAX_CHUNK
+		}
+		op := fmt.Sprintf("read 0x%08x", addr)
+		if err := dev.address(op, _CMD_READ_MEMORY, addr); err != nil {
+			return err
+		}
+		if err := dev.write(op, []byte{byte(n - 1), ^byte(n - 1)}); err != nil {
+			return err
+		}
+		if err := dev.ack(op); err != nil {
+			return err
+		}
+		r, err := dev.read(op, n)
+		if err != nil {
+			return err
+		}
+		copy(b, r)
+		b, addr = b[n:], addr+uint32(n)
+	}
+	return nil
+}
+
+// WriteMemory writes data at addr, the flash must have been erased. addr must
+// be a multiple of 4, data is padded with 0xFF to a multiple of 4 bytes.
+func (dev *Dev) WriteMemory(addr uint32, data []byte) error {
+	if addr%4 != 0 {
+		return deverr.Paramf("address 0x%08x not aligned on 4 bytes", addr)
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > MAX_CHUNK {
+			n = MAX_CHUNK
+		}
+		chunk := append([]byte(nil), data[:n]...)
+		for len(chunk)%4 != 0 {
+			chunk = append(chunk, 0xFF)
+		}
+		op := fmt.Sprintf("write 0x%08x", addr)
+		if err := dev.address(op, _CMD_WRITE_MEMORY, addr); err != nil {
+			return err
+		}
+		if err := dev.frame(op, append([]byte{byte(len(chunk) - 1)}, chunk...)); err != nil {
+			return err
+		}
+		data, addr = data[n:], addr+uint32(n)
+	}
+	return nil
+}
+
+// ErasePages erases n pages from page first, counted from FLASH_BASE.
+func (dev *Dev) ErasePages(first, n int) error {
+	if first < 0 || n < 1 || first+n > 0xFFF0 {
+		return deverr.Paramf("invalid pages %d-%d", first, first+n-1)
+	}
+	op := fmt.Sprintf("erase pages %d-%d", first, first+n-1)
+	if err := dev.command(op, _CMD_EXTENDED_ERASE); err != nil {
+		return err
+	}
+	w := []byte{byte((n - 1) >> 8), byte(n - 1)}
+	for p := first; p < first+n; p++ {
+		w = append(w, byte(p>>8), byte(p))
+	}
+	return dev.frame(op, w)
+}
+
+// Go starts the code at addr, the bootloader stops answering.
+func (dev *Dev) Go(addr uint32) error {
+	return dev.address(fmt.Sprintf("go 0x%08x", addr), _CMD_GO, addr)
+}
+
+// Flash erases the pages covering image at AppAddress, writes it, reads it
+// back and starts it. progress is called after each step when not nil.
+func (dev *Dev) Flash(image []byte, progress func(Progress)) error {
+	if len(image) == 0 {
+		return deverr.Paramf("empty image")
+	}
+	report := func(s Stage, done, total int) {
+		if progress != nil {
+			progress(Progress{Stage: s, Done: done, Total: total})
+		}
+	}
+	base, size := dev.opts.AppAddress, dev.opts.PageSize
+	first := int(base-FLASH_BASE) / size
+	pages := (len(image) + size - 1) / size
+	for i := 0; i < pages; i++ {
+		if err := dev.ErasePages(first+i, 1); err != nil {
+			return err
+		}
+		report(STAGE_ERASE, (i+1)*size, pages*size)
+	}
+	for off := 0; off < len(image); off += MAX_CHUNK {
+		end := off + MAX_CHUNK
+		if end > len(image) {
+			end = len(image)
+		}
+		if err := dev.WriteMemory(base+uint32(off), image[off:end]); err != nil {
+			return err
+		}
+		report(STAGE_WRITE, end, len(image))
+	}
+	r := make([]byte, MAX_CHUNK)
+	for off := 0; off < len(image); off += MAX_CHUNK {
+		end := off + MAX_CHUNK
+		if end > len(image) {
+			end = len(image)
+		}
+		if err := dev.ReadMemory(base+uint32(off), r[:end-off]); err != nil {
+			return err
+		}
+		if !bytes.Equal(r[:end-off], image[off:end]) {
+			return fmt.Errorf("%w: verify failed at 0x%08x", deverr.ErrDevice, base+uint32(off))
+		}
+		report(STAGE_VERIFY, end, len(image))
+	}
+	if err := dev.Go(base); err != nil {
+		return err
+	}
+	report(STAGE_START, len(image), len(image))
+	return nil
+}
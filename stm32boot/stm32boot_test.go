@@ -0,0 +1,108 @@
+package stm32boot
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"devices/deverr"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+)
+
+const bootAddr = 0x54
+
+func newBoot(t *testing.T) (*Dev, *sim.STM32Boot) {
+	b := i2cemu.NewBus()
+	s := sim.NewSTM32Boot(16*1024, 1024)
+	s.Protected = 2048
+	b.Attach(bootAddr, s)
+	opts := DefaultOpts
+	opts.I2cAddress = bootAddr
+	opts.AppAddress = FLASH_BASE + 2048
+	opts.BootSize = 2048
+	dev, err := New(b, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dev, s
+}
+
+func TestFlash(t *testing.T) {
+	dev, s := newBoot(t)
+	if dev.Version() != 0x10 || dev.PID() != 0x0444 {
+		t.Errorf("version 0x%02x PID 0x%04x", dev.Version(), dev.PID())
+	}
+	// previous firmware
+	if err := dev.WriteMemory(FLASH_BASE+4096, bytes.Repeat([]byte{0x5A}, 1024)); err != nil {
+		t.Fatal(err)
+	}
+
+	image := make([]byte, 3001)
+	rand.New(rand.NewSource(1)).Read(image)
+	var stages []Progress
+	if err := dev.Flash(image, func(p Progress) { stages = append(stages, p) }); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Image(FLASH_BASE+2048, len(image)); !bytes.Equal(got, image) {
+		t.Errorf("flash content differs from the image")
+	}
+	if s.Started != FLASH_BASE+2048 {
+		t.Errorf("started at 0x%08x", s.Started)
+	}
+	// 3 pages, 12 chunks written and verified, start
+	if len(stages) != 3+12+12+1 {
+		t.Fatalf("%d progress reports, want 28", len(stages))
+	}
+	want := []Progress{
+		{STAGE_ERASE, 1024, 3072},
+		{STAGE_ERASE, 3072, 3072},
+		{STAGE_WRITE, 256, 3001},
+		{STAGE_WRITE, 3001, 3001},
+		{STAGE_VERIFY, 3001, 3001},
+		{STAGE_START, 3001, 3001},
+	}
+	for i, j := range []int{0, 2, 3, 14, 26, 27} {
+		if stages[j] != want[i] {
+			t.Errorf("progress %d = %+v, want %+v", j, stages[j], want[i])
+		}
+	}
+	// the bootloader pages are kept
+	if got := s.Image(FLASH_BASE, 2048); !bytes.Equal(got, bytes.Repeat([]byte{0xFF}, 2048)) {
+		t.Errorf("bootloader pages changed")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dev, s := newBoot(t)
+	if err := dev.ErasePages(1, 1); !errors.Is(err, deverr.ErrDevice) {
+		t.Errorf("ErasePages() of the bootloader = %v", err)
+	}
+	if err := dev.WriteMemory(FLASH_BASE+2050, []byte{1}); !errors.Is(err, deverr.ErrParameter) {
+		t.Errorf("WriteMemory() unaligned = %v", err)
+	}
+	// page 0 of 4KB holds the bootloader
+	dev.opts.PageSize = 4096
+	if err := dev.Flash([]byte{0xF0}, nil); err == nil {
+		t.Errorf("Flash() over the bootloader succeeded")
+	}
+	if s.Started != 0 {
+		t.Errorf("application started after a failure")
+	}
+
+	b := i2cemu.NewBus()
+	opts := DefaultOpts
+	opts.I2cAddress = bootAddr
+	opts.AppAddress = FLASH_BASE
+	if _, err := New(b, &opts); !errors.Is(err, deverr.ErrNotDetected) {
+		t.Errorf("New() without bootloader = %v", err)
+	}
+	opts.BootSize = 2048
+	for _, a := range []uint32{0, FLASH_BASE, FLASH_BASE + 1024, FLASH_BASE + 2148} {
+		opts.AppAddress = a
+		if _, err := New(b, &opts); !errors.Is(err, deverr.ErrParameter) {
+			t.Errorf("New() with application at 0x%08x = %v", a, err)
+		}
+	}
+}
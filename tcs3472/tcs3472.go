@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"time"
 
+	"devices/deverr"
+
 	"periph.io/x/conn/v3/i2c"
 )
 
@@ -111,7 +113,7 @@ var DefaultOpts = Opts{
 // New creates a new driver.
 func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
 	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x70 {
-		return nil, fmt.Errorf("invalid device address")
+		return nil, deverr.Paramf("invalid device address")
 	}
 
 	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}
@@ -133,13 +135,19 @@ func (h *Dev) Close() {
 func (h *Dev) readBytes(reg int, size int) ([]uint8, error) {
 	r := make([]byte, size)
 	err := h.c.Tx([]byte{byte(TCS34725_COMMAND_BIT | reg)}, r)
-	return r, err
+	if err != nil {
+		return r, deverr.Bus(h.c.Addr, fmt.Sprintf("read register 0x%02x", reg), err)
+	}
+	return r, nil
 }
 
 func (h *Dev) writeBytes(reg int, data []uint8) error {
 	d := []byte{byte(TCS34725_COMMAND_BIT | reg)}
 	d = append(d, data...)
-	return h.c.Tx(d, nil)
+	if err := h.c.Tx(d, nil); err != nil {
+		return deverr.Bus(h.c.Addr, fmt.Sprintf("write register 0x%02x", reg), err)
+	}
+	return nil
 }
 
 func (h *Dev) SetIntegrationTime(time IntegrationTime) error {
@@ -153,7 +161,7 @@ func (h *Dev) SetIntegrationTime(time IntegrationTime) error {
 }
 func (h *Dev) SetGain(gain TCS34725Gain) error {
 	buf := []byte{byte(gain)}
-	err := h.writeBytes(TCS3472_ATIME, buf)
+	err := h.writeBytes(TCS3472_CONTROL, buf)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,9 @@
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package vl53l0x - Time-of-Flight ranging sensor
+//
+// Product page: https://www.st.com/en/imaging-and-photonics-solutions/vl53l0x.html
+// Datasheet:    doc/vl53l0x.pdf
+// Source code:  https://github.com/pololu/vl53l0x-arduino
+package vl53l0x
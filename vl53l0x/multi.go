@@ -0,0 +1,82 @@
+package vl53l0x
+
+import (
+	"fmt"
+	"time"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/i2c"
+)
+
+// SetAddress changes the I2C address of the sensor until it is powered off or reset.
+func (h *Dev) SetAddress(addr uint16) error {
+	if addr < 0x01 || addr > 0x7F {
+		return deverr.Paramf("invalid device address")
+	}
+	if err := h.writeReg(I2C_SLAVE_DEVICE_ADDRESS, uint8(addr&0x7F)); err != nil {
+		return err
+	}
+	h.c.Addr = addr
+	return nil
+}
+
+// GetAddress returns the current I2C address of the sensor.
+func (h *Dev) GetAddress() uint16 {
+	return h.c.Addr
+}
+
+// NewMulti brings up several sensors sharing one bus.
+// All sensors boot at I2CAddr, so they are held in reset with their XSHUT pin
+// and released one at a time to be moved to addrs[i].
+// Only the last sensor may keep I2CAddr. Other devices answering at 0x29,
+// like the TCS3472, must be on another bus. opts.I2cAddress is ignored.
+func NewMulti(bus i2c.Bus, xshut []gpio.PinOut, addrs []uint16, opts *Opts) ([]*Dev, error) {
+	if len(xshut) != len(addrs) {
+		return nil, deverr.Paramf("%d XSHUT pins for %d addresses", len(xshut), len(addrs))
+	}
+	seen := map[uint16]bool{}
+	for i, a := range addrs {
+		if a < 0x01 || a > 0x7F {
+			return nil, deverr.Paramf("invalid device address 0x%02x", a)
+		}
+		if seen[a] {
+			return nil, deverr.Paramf("duplicate device address 0x%02x", a)
+		}
+		if a == I2CAddr && i != len(addrs)-1 {
+			return nil, deverr.Paramf("only the last sensor may keep address 0x%02x", I2CAddr)
+		}
+		seen[a] = true
+	}
+
+	for _, p := range xshut {
+		if err := p.Out(gpio.Low); err != nil {
+			return nil, err
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	devs := make([]*Dev, 0, len(addrs))
+	for i, p := range xshut {
+		if err := p.Out(gpio.High); err != nil {
+			return devs, err
+		}
+		// tBOOT is 1.2ms max
+		time.Sleep(2 * time.Millisecond)
+		if addrs[i] != I2CAddr {
+			boot := &Dev{c: i2c.Dev{Bus: bus, Addr: I2CAddr}}
+			if err := boot.SetAddress(addrs[i]); err != nil {
+				return devs, fmt.Errorf("sensor %d: %w", i, err)
+			}
+		}
+		o := *opts
+		o.I2cAddress = addrs[i]
+		dev, err := New(bus, &o)
+		if err != nil {
+			return devs, fmt.Errorf("sensor %d at 0x%02x: %w", i, addrs[i], err)
+		}
+		devs = append(devs, dev)
+	}
+	return devs, nil
+}
@@ -0,0 +1,160 @@
+package vl53l0x
+
+import (
+	"fmt"
+	"time"
+
+	"devices/deverr"
+)
+
+// Profile is one of the ranging profiles of the ST API user manual (UM2039).
+type Profile int
+
+const (
+	PROFILE_DEFAULT       Profile = iota // 33ms, 1.2m
+	PROFILE_HIGH_ACCURACY                // 200ms, 1.2m, < ±3% accuracy
+	PROFILE_LONG_RANGE                   // 33ms, 2m in the dark
+	PROFILE_HIGH_SPEED                   // 20ms, 1.2m, ±5% accuracy
+)
+
+type profileSettings struct {
+	timingBudget    time.Duration
+	signalRateLimit float32 // MCPS
+	preRangePeriod  uint16  // VCSEL pulse periods in PCLKs
+	finalPeriod     uint16
+}
+
+// The sigma limit checks of the ST profiles are computed by the host API, they are not applied here.
+var profiles = map[Profile]profileSettings{
+	PROFILE_DEFAULT:       {33 * time.Millisecond, 0.25, 14, 10},
+	PROFILE_HIGH_ACCURACY: {200 * time.Millisecond, 0.25, 14, 10},
+	PROFILE_LONG_RANGE:    {33 * time.Millisecond, 0.1, 18, 14},
+	PROFILE_HIGH_SPEED:    {20 * time.Millisecond, 0.25, 14, 10},
+}
+
+func (p Profile) String() string {
+	switch p {
+	case PROFILE_DEFAULT:
+		return "default"
+	case PROFILE_HIGH_ACCURACY:
+		return "high accuracy"
+	case PROFILE_LONG_RANGE:
+		return "long range"
+	case PROFILE_HIGH_SPEED:
+		return "high speed"
+	}
+	return fmt.Sprintf("profile %d", int(p))
+}
+
+// ApplyProfile sets the signal rate limit, VCSEL pulse periods and timing budget of a profile.
+func (h *Dev) ApplyProfile(p Profile) error {
+	s, ok := profiles[p]
+	if !ok {
+		return deverr.Paramf("unknown profile %d", int(p))
+	}
+	if err := h.SetSignalRateLimit(s.signalRateLimit); err != nil {
+		return err
+	}
+	if err := h.SetVcselPulsePeriod(VCSEL_PERIOD_PRE_RANGE, s.preRangePeriod); err != nil {
+		return err
+	}
+	if err := h.SetVcselPulsePeriod(VCSEL_PERIOD_FINAL_RANGE, s.finalPeriod); err != nil {
+		return err
+	}
+	return h.SetMeasurementTimingBudget(s.timingBudget)
+}
+
+// SetVcselPulsePeriod sets the VCSEL pulse period in PCLKs of the pre-range (12 to 18)
+// or final range (8 to 14) step. Longer periods increase the potential range.
+// The timing budget is kept and the phase calibration is run again.
+func (h *Dev) SetVcselPulsePeriod(t VcselPeriodType, pclks uint16) error {
+	e, err := h.getSequenceStepEnables()
+	if err != nil {
+		return err
+	}
+	timeouts, err := h.getSequenceStepTimeouts(e)
+	if err != nil {
+		return err
+	}
+	period := encodeVcselPeriod(pclks)
+
+	if t == VCSEL_PERIOD_PRE_RANGE {
+		phaseHigh := map[uint16]uint8{12: 0x18, 14: 0x30, 16: 0x40, 18: 0x50}
+		high, ok := phaseHigh[pclks]
+		if !ok {
+			return deverr.Paramf("pre-range VCSEL period must be 12, 14, 16 or 18")
+		}
+		if err := h.writeRegs([][2]uint8{
+			{PRE_RANGE_CONFIG_VALID_PHASE_HIGH, high},
+			{PRE_RANGE_CONFIG_VALID_PHASE_LOW, 0x08},
+			{PRE_RANGE_CONFIG_VCSEL_PERIOD, period},
+		}); err != nil {
+			return err
+		}
+		// keep the pre-range and MSRC timeouts
+		mclks := timeoutMicrosecondsToMclks(timeouts.preRangeUs, pclks)
+		if err := h.writeReg16(PRE_RANGE_CONFIG_TIMEOUT_MACROP_HI, encodeTimeout(mclks)); err != nil {
+			return err
+		}
+		msrc := timeoutMicrosecondsToMclks(timeouts.msrcDssTccUs, pclks)
+		if msrc > 256 {
+			msrc = 256
+		}
+		if err := h.writeReg(MSRC_CONFIG_TIMEOUT_MACROP, uint8(msrc-1)); err != nil {
+			return err
+		}
+	} else {
+		// VALID_PHASE_HIGH, VCSEL_WIDTH, PHASECAL_CONFIG_TIMEOUT, PHASECAL_LIM
+		settings := map[uint16][4]uint8{
+			8:  {0x10, 0x02, 0x0C, 0x30},
+			10: {0x28, 0x03, 0x09, 0x20},
+			12: {0x38, 0x03, 0x08, 0x20},
+			14: {0x48, 0x03, 0x07, 0x20},
+		}
+		s, ok := settings[pclks]
+		if !ok {
+			return deverr.Paramf("final range VCSEL period must be 8, 10, 12 or 14")
+		}
+		if err := h.writeRegs([][2]uint8{
+			{FINAL_RANGE_CONFIG_VALID_PHASE_HIGH, s[0]},
+			{FINAL_RANGE_CONFIG_VALID_PHASE_LOW, 0x08},
+			{GLOBAL_CONFIG_VCSEL_WIDTH, s[1]},
+			{ALGO_PHASECAL_CONFIG_TIMEOUT, s[2]},
+			{0xFF, 0x01},
+			{ALGO_PHASECAL_LIM, s[3]},
+			{0xFF, 0x00},
+			{FINAL_RANGE_CONFIG_VCSEL_PERIOD, period},
+		}); err != nil {
+			return err
+		}
+		// keep the final range timeout, it includes the pre-range timeout
+		mclks := timeoutMicrosecondsToMclks(timeouts.finalRangeUs, pclks)
+		if e.preRange {
+			mclks += uint32(timeouts.preRangeMclks)
+		}
+		if err := h.writeReg16(FINAL_RANGE_CONFIG_TIMEOUT_MACROP_HI, encodeTimeout(mclks)); err != nil {
+			return err
+		}
+	}
+
+	if err := h.setMeasurementTimingBudget(h.timingBudget); err != nil {
+		return err
+	}
+	// phase calibration with the new period
+	seq, err := h.readReg(SYSTEM_SEQUENCE_CONFIG)
+	if err != nil {
+		return err
+	}
+	if err := h.writeReg(SYSTEM_SEQUENCE_CONFIG, 0x02); err != nil {
+		return err
+	}
+	if err := h.singleRefCalibration(SYSRANGE_PHASE_CALIBRATION); err != nil {
+		return err
+	}
+	return h.writeReg(SYSTEM_SEQUENCE_CONFIG, seq)
+}
+
+// GetVcselPulsePeriod returns the VCSEL pulse period in PCLKs.
+func (h *Dev) GetVcselPulsePeriod(t VcselPeriodType) (uint16, error) {
+	return h.getVcselPulsePeriod(t)
+}
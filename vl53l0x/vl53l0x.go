@@ -0,0 +1,817 @@
+package vl53l0x
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/physic"
+)
+
+const (
+	VL53L0X_ADDRESS  = 0x29
+	VL53L0X_MODEL_ID = 0xEE
+
+	SYSRANGE_START                              = 0x00
+	SYSTEM_SEQUENCE_CONFIG                      = 0x01
+	SYSTEM_INTERMEASUREMENT_PERIOD              = 0x04
+	SYSTEM_RANGE_CONFIG                         = 0x09
+	SYSTEM_INTERRUPT_CONFIG_GPIO                = 0x0A
+	SYSTEM_INTERRUPT_CLEAR                      = 0x0B
+	SYSTEM_THRESH_HIGH                          = 0x0C
+	SYSTEM_THRESH_LOW                           = 0x0E
+	RESULT_INTERRUPT_STATUS                     = 0x13
+	RESULT_RANGE_STATUS                         = 0x14
+	CROSSTALK_COMPENSATION_PEAK_RATE_MCPS       = 0x20
+	PRE_RANGE_CONFIG_MIN_SNR                    = 0x27
+	ALGO_PART_TO_PART_RANGE_OFFSET_MM           = 0x28
+	ALGO_PHASECAL_LIM                           = 0x30
+	ALGO_PHASECAL_CONFIG_TIMEOUT                = 0x30
+	GLOBAL_CONFIG_VCSEL_WIDTH                   = 0x32
+	FINAL_RANGE_CONFIG_MIN_COUNT_RATE_RTN_LIMIT = 0x44
+	MSRC_CONFIG_TIMEOUT_MACROP                  = 0x46
+	FINAL_RANGE_CONFIG_VALID_PHASE_LOW          = 0x47
+	FINAL_RANGE_CONFIG_VALID_PHASE_HIGH         = 0x48
+	DYNAMIC_SPAD_NUM_REQUESTED_REF_SPAD         = 0x4E
+	DYNAMIC_SPAD_REF_EN_START_OFFSET            = 0x4F
+	PRE_RANGE_CONFIG_VCSEL_PERIOD               = 0x50
+	PRE_RANGE_CONFIG_TIMEOUT_MACROP_HI          = 0x51
+	PRE_RANGE_CONFIG_VALID_PHASE_LOW            = 0x56
+	PRE_RANGE_CONFIG_VALID_PHASE_HIGH           = 0x57
+	MSRC_CONFIG_CONTROL                         = 0x60
+	PRE_RANGE_CONFIG_SIGMA_THRESH_HI            = 0x61
+	PRE_RANGE_CONFIG_SIGMA_THRESH_LO            = 0x62
+	PRE_RANGE_MIN_COUNT_RATE_RTN_LIMIT          = 0x64
+	FINAL_RANGE_CONFIG_MIN_SNR                  = 0x67
+	FINAL_RANGE_CONFIG_VCSEL_PERIOD             = 0x70
+	FINAL_RANGE_CONFIG_TIMEOUT_MACROP_HI        = 0x71
+	POWER_MANAGEMENT_GO1_POWER_FORCE            = 0x80
+	SYSTEM_HISTOGRAM_BIN                        = 0x81
+	GPIO_HV_MUX_ACTIVE_HIGH                     = 0x84
+	VHV_CONFIG_PAD_SCL_SDA_EXTSUP_HV            = 0x89
+	I2C_SLAVE_DEVICE_ADDRESS                    = 0x8A
+	GLOBAL_CONFIG_SPAD_ENABLES_REF_0            = 0xB0
+	GLOBAL_CONFIG_REF_EN_START_SELECT           = 0xB6
+	RESULT_PEAK_SIGNAL_RATE_REF                 = 0xB6
+	RESULT_CORE_AMBIENT_WINDOW_EVENTS_RTN       = 0xBC
+	SOFT_RESET_GO2_SOFT_RESET_N                 = 0xBF
+	IDENTIFICATION_MODEL_ID                     = 0xC0
+	IDENTIFICATION_REVISION_ID                  = 0xC2
+	OSC_CALIBRATE_VAL                           = 0xF8
+)
+
+// SYSRANGE_START modes
+const (
+	SYSRANGE_MODE_SINGLESHOT   = 0x01
+	SYSRANGE_MODE_BACKTOBACK   = 0x02
+	SYSRANGE_MODE_TIMED        = 0x04
+	SYSRANGE_MODE_START_STOP   = 0x01
+	SYSRANGE_VHV_CALIBRATION   = 0x40
+	SYSRANGE_PHASE_CALIBRATION = 0x00
+)
+
+// RangeStatus is the device range status, bits 6:3 of RESULT_RANGE_STATUS.
+type RangeStatus byte
+
+const (
+	RANGE_STATUS_NONE                   RangeStatus = 0
+	RANGE_STATUS_VCSEL_CONTINUITY_TEST  RangeStatus = 1
+	RANGE_STATUS_VCSEL_WATCHDOG_TEST    RangeStatus = 2
+	RANGE_STATUS_NO_VHV_VALUE_FOUND     RangeStatus = 3
+	RANGE_STATUS_MSRC_NO_TARGET         RangeStatus = 4
+	RANGE_STATUS_SNR_CHECK              RangeStatus = 5
+	RANGE_STATUS_RANGE_PHASE_CHECK      RangeStatus = 6
+	RANGE_STATUS_SIGMA_THRESHOLD_CHECK  RangeStatus = 7
+	RANGE_STATUS_TCC                    RangeStatus = 8
+	RANGE_STATUS_PHASE_CONSISTENCY      RangeStatus = 9
+	RANGE_STATUS_MIN_CLIP               RangeStatus = 10
+	RANGE_STATUS_RANGE_COMPLETE         RangeStatus = 11
+	RANGE_STATUS_ALGO_UNDERFLOW         RangeStatus = 12
+	RANGE_STATUS_ALGO_OVERFLOW          RangeStatus = 13
+	RANGE_STATUS_RANGE_IGNORE_THRESHOLD RangeStatus = 14
+)
+
+var rangeStatusNames = []string{
+	"none",
+	"VCSEL continuity test failure",
+	"VCSEL watchdog test failure",
+	"no VHV value found",
+	"MSRC no target",
+	"SNR check",
+	"range phase check",
+	"sigma threshold check",
+	"TCC",
+	"phase consistency",
+	"min clip",
+	"range complete",
+	"range algo underflow",
+	"range algo overflow",
+	"range ignore threshold",
+}
+
+func (s RangeStatus) String() string {
+	if int(s) < len(rangeStatusNames) {
+		return rangeStatusNames[s]
+	}
+	return fmt.Sprintf("unknown status %d", s)
+}
+
+// Valid reports whether the measured distance can be used.
+func (s RangeStatus) Valid() bool {
+	return s == RANGE_STATUS_RANGE_COMPLETE
+}
+
+// HardwareFailure reports VCSEL and VHV failures.
+func (s RangeStatus) HardwareFailure() bool {
+	return s >= RANGE_STATUS_VCSEL_CONTINUITY_TEST && s <= RANGE_STATUS_NO_VHV_VALUE_FOUND
+}
+
+// Range is a ranging measurement.
+type Range struct {
+	Distance physic.Distance
+	Status   RangeStatus
+}
+
+// VcselPeriodType selects the pre-range or final range VCSEL pulse period.
+type VcselPeriodType int
+
+const (
+	VCSEL_PERIOD_PRE_RANGE VcselPeriodType = iota
+	VCSEL_PERIOD_FINAL_RANGE
+)
+
+type sequenceStepEnables struct {
+	tcc, msrc, dss, preRange, finalRange bool
+}
+
+type sequenceStepTimeouts struct {
+	preRangeVcselPeriodPclks, finalRangeVcselPeriodPclks uint16
+	msrcDssTccMclks, preRangeMclks, finalRangeMclks      uint16
+	msrcDssTccUs, preRangeUs, finalRangeUs               uint32
+}
+
+// timing budget overheads in µs
+const (
+	_START_OVERHEAD       = 1910
+	_END_OVERHEAD         = 960
+	_MSRC_OVERHEAD        = 660
+	_TCC_OVERHEAD         = 590
+	_DSS_OVERHEAD         = 690
+	_PRE_RANGE_OVERHEAD   = 660
+	_FINAL_RANGE_OVERHEAD = 550
+	_MIN_TIMING_BUDGET    = 20000
+)
+
+// ioTimeout bounds the polling loops waiting for the device.
+const ioTimeout = 500 * time.Millisecond
+
+// I2CAddr is the default I2C address for the VL53L0X.
+const I2CAddr uint16 = VL53L0X_ADDRESS
+
+// Opts holds the configuration options.
+// TimingBudget and SignalRateLimit override the profile values when not zero.
+type Opts struct {
+	I2cAddress      uint16
+	Profile         Profile
+	TimingBudget    time.Duration // measurement timing budget, 20ms minimum
+	SignalRateLimit float32       // return signal rate limit in MCPS
+	IO2V8           bool          // I/O pads at 2.8V instead of 1.8V
+}
+
+// DefaultOpts are the recommended default options.
+var DefaultOpts = Opts{
+	I2cAddress: I2CAddr,
+	Profile:    PROFILE_DEFAULT,
+	IO2V8:      true,
+}
+
+// Dev is an handle to a VL53L0X ToF sensor.
+type Dev struct {
+	c            i2c.Dev
+	stopVariable uint8
+	timingBudget uint32 // µs
+}
+
+// New creates a new driver and runs the reference initialisation sequence.
+func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
+	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x7F {
+		return nil, deverr.Paramf("invalid device address")
+	}
+
+	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}
+	id, err := dev.GetModelId()
+	if err != nil {
+		return nil, deverr.NotDetected(dev.c.Addr, err)
+	}
+	if id != VL53L0X_MODEL_ID {
+		return nil, deverr.NotDetected(dev.c.Addr, fmt.Errorf("model id 0x%02x", id))
+	}
+	if err := dev.init(opts.IO2V8); err != nil {
+		return nil, err
+	}
+	if err := dev.ApplyProfile(opts.Profile); err != nil {
+		return nil, err
+	}
+	if opts.SignalRateLimit != 0 {
+		if err := dev.SetSignalRateLimit(opts.SignalRateLimit); err != nil {
+			return nil, err
+		}
+	}
+	if opts.TimingBudget != 0 {
+		if err := dev.SetMeasurementTimingBudget(opts.TimingBudget); err != nil {
+			return nil, err
+		}
+	}
+	return dev, nil
+}
+
+func (h *Dev) Close() {
+	if h != nil {
+		h.StopContinuous()
+	}
+}
+
+func (h *Dev) readBytes(reg int, size int) ([]uint8, error) {
+	r := make([]byte, size)
+	err := h.c.Tx([]byte{byte(reg)}, r)
+	if err != nil {
+		return r, deverr.Bus(h.c.Addr, fmt.Sprintf("read register 0x%02x", reg), err)
+	}
+	return r, nil
+}
+
+func (h *Dev) writeBytes(reg int, data []uint8) error {
+	d := []byte{byte(reg)}
+	d = append(d, data...)
+	if err := h.c.Tx(d, nil); err != nil {
+		return deverr.Bus(h.c.Addr, fmt.Sprintf("write register 0x%02x", reg), err)
+	}
+	return nil
+}
+
+func (h *Dev) readReg(reg int) (uint8, error) {
+	data, err := h.readBytes(reg, 1)
+	if err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+func (h *Dev) readReg16(reg int) (uint16, error) {
+	data, err := h.readBytes(reg, 2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(data), nil
+}
+
+func (h *Dev) writeReg(reg int, value uint8) error {
+	return h.writeBytes(reg, []uint8{value})
+}
+
+func (h *Dev) writeReg16(reg int, value uint16) error {
+	return h.writeBytes(reg, []uint8{uint8(value >> 8), uint8(value)})
+}
+
+func (h *Dev) writeReg32(reg int, value uint32) error {
+	data := make([]uint8, 4)
+	binary.BigEndian.PutUint32(data, value)
+	return h.writeBytes(reg, data)
+}
+
+// writeRegs writes a sequence of (register, value) pairs.
+func (h *Dev) writeRegs(regs [][2]uint8) error {
+	for _, r := range regs {
+		if err := h.writeReg(int(r[0]), r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitReg polls reg until cond is true.
+func (h *Dev) waitReg(reg int, cond func(uint8) bool) error {
+	deadline := time.Now().Add(ioTimeout)
+	for {
+		v, err := h.readReg(reg)
+		if err != nil {
+			return err
+		}
+		if cond(v) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: timeout waiting for register 0x%02x", deverr.ErrDevice, reg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// GetModelId returns IDENTIFICATION_MODEL_ID, 0xEE for VL53L0X.
+func (h *Dev) GetModelId() (uint8, error) {
+	return h.readReg(IDENTIFICATION_MODEL_ID)
+}
+
+// GetRevisionId returns IDENTIFICATION_REVISION_ID.
+func (h *Dev) GetRevisionId() (uint8, error) {
+	return h.readReg(IDENTIFICATION_REVISION_ID)
+}
+
+// init is the DataInit, StaticInit and PerformRefCalibration sequence of the ST API.
+func (h *Dev) init(io2v8 bool) error {
+	// DataInit
+	if io2v8 {
+		v, err := h.readReg(VHV_CONFIG_PAD_SCL_SDA_EXTSUP_HV)
+		if err != nil {
+			return err
+		}
+		if err := h.writeReg(VHV_CONFIG_PAD_SCL_SDA_EXTSUP_HV, v|0x01); err != nil {
+			return err
+		}
+	}
+	// I2C standard mode
+	if err := h.writeRegs([][2]uint8{{0x88, 0x00}, {0x80, 0x01}, {0xFF, 0x01}, {0x00, 0x00}}); err != nil {
+		return err
+	}
+	stop, err := h.readReg(0x91)
+	if err != nil {
+		return err
+	}
+	h.stopVariable = stop
+	if err := h.writeRegs([][2]uint8{{0x00, 0x01}, {0xFF, 0x00}, {0x80, 0x00}}); err != nil {
+		return err
+	}
+	// disable SIGNAL_RATE_MSRC and SIGNAL_RATE_PRE_RANGE limit checks
+	v, err := h.readReg(MSRC_CONFIG_CONTROL)
+	if err != nil {
+		return err
+	}
+	if err := h.writeReg(MSRC_CONFIG_CONTROL, v|0x12); err != nil {
+		return err
+	}
+	if err := h.SetSignalRateLimit(0.25); err != nil {
+		return err
+	}
+	if err := h.writeReg(SYSTEM_SEQUENCE_CONFIG, 0xFF); err != nil {
+		return err
+	}
+
+	// StaticInit
+	if err := h.setReferenceSpads(); err != nil {
+		return err
+	}
+	if err := h.writeRegs(defaultTuningSettings); err != nil {
+		return err
+	}
+	// interrupt on new sample ready, active low
+	if err := h.writeReg(SYSTEM_INTERRUPT_CONFIG_GPIO, 0x04); err != nil {
+		return err
+	}
+	v, err = h.readReg(GPIO_HV_MUX_ACTIVE_HIGH)
+	if err != nil {
+		return err
+	}
+	if err := h.writeReg(GPIO_HV_MUX_ACTIVE_HIGH, v&^0x10); err != nil {
+		return err
+	}
+	if err := h.writeReg(SYSTEM_INTERRUPT_CLEAR, 0x01); err != nil {
+		return err
+	}
+	budget, err := h.getMeasurementTimingBudget()
+	if err != nil {
+		return err
+	}
+	// disable MSRC and TCC by default
+	if err := h.writeReg(SYSTEM_SEQUENCE_CONFIG, 0xE8); err != nil {
+		return err
+	}
+	if err := h.setMeasurementTimingBudget(budget); err != nil {
+		return err
+	}
+
+	// PerformRefCalibration
+	return h.refCalibration()
+}
+
+// setReferenceSpads enables the reference SPADs reported by the NVM.
+func (h *Dev) setReferenceSpads() error {
+	count, aperture, err := h.getSpadInfo()
+	if err != nil {
+		return err
+	}
+	spadMap, err := h.readBytes(GLOBAL_CONFIG_SPAD_ENABLES_REF_0, 6)
+	if err != nil {
+		return err
+	}
+	if err := h.writeRegs([][2]uint8{
+		{0xFF, 0x01},
+		{DYNAMIC_SPAD_REF_EN_START_OFFSET, 0x00},
+		{DYNAMIC_SPAD_NUM_REQUESTED_REF_SPAD, 0x2C},
+		{0xFF, 0x00},
+		{GLOBAL_CONFIG_REF_EN_START_SELECT, 0xB4},
+	}); err != nil {
+		return err
+	}
+	first := 0
+	if aperture {
+		// aperture SPADs start at 12
+		first = 12
+	}
+	enabled := uint8(0)
+	for i := 0; i < 48; i++ {
+		if i < first || enabled == count {
+			spadMap[i/8] &^= 1 << (i % 8)
+		} else if spadMap[i/8]>>(i%8)&0x01 != 0 {
+			enabled++
+		}
+	}
+	return h.writeBytes(GLOBAL_CONFIG_SPAD_ENABLES_REF_0, spadMap)
+}
+
+// getSpadInfo returns the reference SPAD count and type from the NVM.
+func (h *Dev) getSpadInfo() (uint8, bool, error) {
+	if err := h.writeRegs([][2]uint8{{0x80, 0x01}, {0xFF, 0x01}, {0x00, 0x00}, {0xFF, 0x06}}); err != nil {
+		return 0, false, err
+	}
+	v, err := h.readReg(0x83)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := h.writeReg(0x83, v|0x04); err != nil {
+		return 0, false, err
+	}
+	if err := h.writeRegs([][2]uint8{{0xFF, 0x07}, {0x81, 0x01}, {0x80, 0x01}, {0x94, 0x6B}, {0x83, 0x00}}); err != nil {
+		return 0, false, err
+	}
+	if err := h.waitReg(0x83, func(v uint8) bool { return v != 0 }); err != nil {
+		return 0, false, err
+	}
+	if err := h.writeReg(0x83, 0x01); err != nil {
+		return 0, false, err
+	}
+	tmp, err := h.readReg(0x92)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := h.writeRegs([][2]uint8{{0x81, 0x00}, {0xFF, 0x06}}); err != nil {
+		return 0, false, err
+	}
+	v, err = h.readReg(0x83)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := h.writeReg(0x83, v&^0x04); err != nil {
+		return 0, false, err
+	}
+	if err := h.writeRegs([][2]uint8{{0xFF, 0x01}, {0x00, 0x01}, {0xFF, 0x00}, {0x80, 0x00}}); err != nil {
+		return 0, false, err
+	}
+	return tmp & 0x7F, tmp&0x80 != 0, nil
+}
+
+// refCalibration runs the VHV and phase calibrations.
+func (h *Dev) refCalibration() error {
+	if err := h.writeReg(SYSTEM_SEQUENCE_CONFIG, 0x01); err != nil {
+		return err
+	}
+	if err := h.singleRefCalibration(SYSRANGE_VHV_CALIBRATION); err != nil {
+		return err
+	}
+	if err := h.writeReg(SYSTEM_SEQUENCE_CONFIG, 0x02); err != nil {
+		return err
+	}
+	if err := h.singleRefCalibration(SYSRANGE_PHASE_CALIBRATION); err != nil {
+		return err
+	}
+	// restore the previous sequence config
+	return h.writeReg(SYSTEM_SEQUENCE_CONFIG, 0xE8)
+}
+
+func (h *Dev) singleRefCalibration(vhvInit uint8) error {
+	if err := h.writeReg(SYSRANGE_START, SYSRANGE_MODE_START_STOP|vhvInit); err != nil {
+		return err
+	}
+	if err := h.waitReg(RESULT_INTERRUPT_STATUS, func(v uint8) bool { return v&0x07 != 0 }); err != nil {
+		return err
+	}
+	if err := h.writeReg(SYSTEM_INTERRUPT_CLEAR, 0x01); err != nil {
+		return err
+	}
+	return h.writeReg(SYSRANGE_START, 0x00)
+}
+
+// SetSignalRateLimit sets the return signal rate limit check value in MCPS.
+// Lower values increase the potential range but are more likely to report
+// reflections of unintended objects.
+func (h *Dev) SetSignalRateLimit(limit float32) error {
+	if limit < 0 || limit > 511.99 {
+		return deverr.Paramf("signal rate limit out of range: 0-511.99")
+	}
+	// Q9.7 fixed point
+	return h.writeReg16(FINAL_RANGE_CONFIG_MIN_COUNT_RATE_RTN_LIMIT, uint16(limit*(1<<7)))
+}
+
+// GetSignalRateLimit returns the return signal rate limit check value in MCPS.
+func (h *Dev) GetSignalRateLimit() (float32, error) {
+	v, err := h.readReg16(FINAL_RANGE_CONFIG_MIN_COUNT_RATE_RTN_LIMIT)
+	if err != nil {
+		return 0, err
+	}
+	return float32(v) / (1 << 7), nil
+}
+
+func (h *Dev) getSequenceStepEnables() (sequenceStepEnables, error) {
+	v, err := h.readReg(SYSTEM_SEQUENCE_CONFIG)
+	if err != nil {
+		return sequenceStepEnables{}, err
+	}
+	return sequenceStepEnables{
+		tcc:        v>>4&0x01 != 0,
+		dss:        v>>3&0x01 != 0,
+		msrc:       v>>2&0x01 != 0,
+		preRange:   v>>6&0x01 != 0,
+		finalRange: v>>7&0x01 != 0,
+	}, nil
+}
+
+func (h *Dev) getVcselPulsePeriod(t VcselPeriodType) (uint16, error) {
+	reg := PRE_RANGE_CONFIG_VCSEL_PERIOD
+	if t == VCSEL_PERIOD_FINAL_RANGE {
+		reg = FINAL_RANGE_CONFIG_VCSEL_PERIOD
+	}
+	v, err := h.readReg(reg)
+	if err != nil {
+		return 0, err
+	}
+	return decodeVcselPeriod(v), nil
+}
+
+func (h *Dev) getSequenceStepTimeouts(enables sequenceStepEnables) (sequenceStepTimeouts, error) {
+	var t sequenceStepTimeouts
+	var err error
+	if t.preRangeVcselPeriodPclks, err = h.getVcselPulsePeriod(VCSEL_PERIOD_PRE_RANGE); err != nil {
+		return t, err
+	}
+	v, err := h.readReg(MSRC_CONFIG_TIMEOUT_MACROP)
+	if err != nil {
+		return t, err
+	}
+	t.msrcDssTccMclks = uint16(v) + 1
+	t.msrcDssTccUs = timeoutMclksToMicroseconds(t.msrcDssTccMclks, t.preRangeVcselPeriodPclks)
+
+	r, err := h.readReg16(PRE_RANGE_CONFIG_TIMEOUT_MACROP_HI)
+	if err != nil {
+		return t, err
+	}
+	t.preRangeMclks = decodeTimeout(r)
+	t.preRangeUs = timeoutMclksToMicroseconds(t.preRangeMclks, t.preRangeVcselPeriodPclks)
+
+	if t.finalRangeVcselPeriodPclks, err = h.getVcselPulsePeriod(VCSEL_PERIOD_FINAL_RANGE); err != nil {
+		return t, err
+	}
+	r, err = h.readReg16(FINAL_RANGE_CONFIG_TIMEOUT_MACROP_HI)
+	if err != nil {
+		return t, err
+	}
+	t.finalRangeMclks = decodeTimeout(r)
+	if enables.preRange {
+		t.finalRangeMclks -= t.preRangeMclks
+	}
+	t.finalRangeUs = timeoutMclksToMicroseconds(t.finalRangeMclks, t.finalRangeVcselPeriodPclks)
+	return t, nil
+}
+
+// usedBudget sums the overheads and timeouts of the enabled steps but the final range timeout.
+func usedBudget(e sequenceStepEnables, t sequenceStepTimeouts) uint32 {
+	budget := uint32(_START_OVERHEAD + _END_OVERHEAD)
+	if e.tcc {
+		budget += t.msrcDssTccUs + _TCC_OVERHEAD
+	}
+	if e.dss {
+		budget += 2 * (t.msrcDssTccUs + _DSS_OVERHEAD)
+	} else if e.msrc {
+		budget += t.msrcDssTccUs + _MSRC_OVERHEAD
+	}
+	if e.preRange {
+		budget += t.preRangeUs + _PRE_RANGE_OVERHEAD
+	}
+	return budget
+}
+
+func (h *Dev) getMeasurementTimingBudget() (uint32, error) {
+	e, err := h.getSequenceStepEnables()
+	if err != nil {
+		return 0, err
+	}
+	t, err := h.getSequenceStepTimeouts(e)
+	if err != nil {
+		return 0, err
+	}
+	budget := usedBudget(e, t)
+	if e.finalRange {
+		budget += t.finalRangeUs + _FINAL_RANGE_OVERHEAD
+	}
+	h.timingBudget = budget
+	return budget, nil
+}
+
+func (h *Dev) setMeasurementTimingBudget(budget uint32) error {
+	if budget < _MIN_TIMING_BUDGET {
+		return deverr.Paramf("timing budget out of range: min 20ms")
+	}
+	e, err := h.getSequenceStepEnables()
+	if err != nil {
+		return err
+	}
+	t, err := h.getSequenceStepTimeouts(e)
+	if err != nil {
+		return err
+	}
+	if e.finalRange {
+		used := usedBudget(e, t) + _FINAL_RANGE_OVERHEAD
+		if used > budget {
+			return deverr.Paramf("timing budget too short, %dµs used by the sequence steps", used)
+		}
+		// The final range timeout includes the pre-range timeout.
+		mclks := timeoutMicrosecondsToMclks(budget-used, t.finalRangeVcselPeriodPclks)
+		if e.preRange {
+			mclks += uint32(t.preRangeMclks)
+		}
+		if err := h.writeReg16(FINAL_RANGE_CONFIG_TIMEOUT_MACROP_HI, encodeTimeout(mclks)); err != nil {
+			return err
+		}
+	}
+	h.timingBudget = budget
+	return nil
+}
+
+// SetMeasurementTimingBudget sets the time allowed for one measurement, 20ms minimum.
+// A longer budget allows more accurate measurements.
+func (h *Dev) SetMeasurementTimingBudget(budget time.Duration) error {
+	return h.setMeasurementTimingBudget(uint32(budget / time.Microsecond))
+}
+
+// GetMeasurementTimingBudget returns the time allowed for one measurement.
+func (h *Dev) GetMeasurementTimingBudget() (time.Duration, error) {
+	budget, err := h.getMeasurementTimingBudget()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(budget) * time.Microsecond, nil
+}
+
+// restoreStopVariable is required before starting a measurement.
+func (h *Dev) restoreStopVariable() error {
+	return h.writeRegs([][2]uint8{
+		{0x80, 0x01},
+		{0xFF, 0x01},
+		{0x00, 0x00},
+		{0x91, h.stopVariable},
+		{0x00, 0x01},
+		{0xFF, 0x00},
+		{0x80, 0x00},
+	})
+}
+
+// StartContinuous starts continuous ranging measurements.
+// If period is 0 the sensor measures back-to-back, otherwise it waits period
+// between measurements (timed mode), period should be longer than the timing budget.
+func (h *Dev) StartContinuous(period time.Duration) error {
+	if err := h.restoreStopVariable(); err != nil {
+		return err
+	}
+	if period == 0 {
+		return h.writeReg(SYSRANGE_START, SYSRANGE_MODE_BACKTOBACK)
+	}
+	ms := uint32(period / time.Millisecond)
+	osc, err := h.readReg16(OSC_CALIBRATE_VAL)
+	if err != nil {
+		return err
+	}
+	if osc != 0 {
+		ms *= uint32(osc)
+	}
+	if err := h.writeReg32(SYSTEM_INTERMEASUREMENT_PERIOD, ms); err != nil {
+		return err
+	}
+	return h.writeReg(SYSRANGE_START, SYSRANGE_MODE_TIMED)
+}
+
+// StopContinuous stops continuous measurements.
+func (h *Dev) StopContinuous() error {
+	return h.writeRegs([][2]uint8{
+		{SYSRANGE_START, SYSRANGE_MODE_SINGLESHOT},
+		{0xFF, 0x01},
+		{0x00, 0x00},
+		{0x91, 0x00},
+		{0x00, 0x01},
+		{0xFF, 0x00},
+	})
+}
+
+// ReadRangeContinuous waits for and returns the next continuous measurement.
+func (h *Dev) ReadRangeContinuous() (Range, error) {
+	if err := h.waitReg(RESULT_INTERRUPT_STATUS, func(v uint8) bool { return v&0x07 != 0 }); err != nil {
+		return Range{}, err
+	}
+	// RESULT_RANGE_STATUS to the range value at RESULT_RANGE_STATUS + 10
+	data, err := h.readBytes(RESULT_RANGE_STATUS, 12)
+	if err != nil {
+		return Range{}, err
+	}
+	if err := h.writeReg(SYSTEM_INTERRUPT_CLEAR, 0x01); err != nil {
+		return Range{}, err
+	}
+	return decodeRange(data), nil
+}
+
+// ReadRangeSingle performs a single-shot measurement.
+func (h *Dev) ReadRangeSingle() (Range, error) {
+	if err := h.restoreStopVariable(); err != nil {
+		return Range{}, err
+	}
+	if err := h.writeReg(SYSRANGE_START, SYSRANGE_MODE_SINGLESHOT); err != nil {
+		return Range{}, err
+	}
+	// wait until the start bit has been cleared
+	if err := h.waitReg(SYSRANGE_START, func(v uint8) bool { return v&0x01 == 0 }); err != nil {
+		return Range{}, err
+	}
+	return h.ReadRangeContinuous()
+}
+
+// decodeRange decodes the RESULT_RANGE_STATUS block.
+func decodeRange(data []byte) Range {
+	return Range{
+		Distance: physic.Distance(binary.BigEndian.Uint16(data[10:])) * physic.MilliMetre,
+		Status:   RangeStatus(data[0] & 0x78 >> 3),
+	}
+}
+
+func decodeVcselPeriod(reg uint8) uint16 {
+	return (uint16(reg) + 1) << 1
+}
+
+func encodeVcselPeriod(pclks uint16) uint8 {
+	return uint8(pclks>>1) - 1
+}
+
+// calcMacroPeriod returns the macro period in ns.
+func calcMacroPeriod(vcselPeriodPclks uint16) uint32 {
+	return (2304*uint32(vcselPeriodPclks)*1655 + 500) / 1000
+}
+
+func timeoutMclksToMicroseconds(mclks uint16, vcselPeriodPclks uint16) uint32 {
+	macro := calcMacroPeriod(vcselPeriodPclks)
+	return (uint32(mclks)*macro + 500) / 1000
+}
+
+func timeoutMicrosecondsToMclks(us uint32, vcselPeriodPclks uint16) uint32 {
+	macro := calcMacroPeriod(vcselPeriodPclks)
+	return (us*1000 + macro/2) / macro
+}
+
+// decodeTimeout decodes the (LSByte * 2^MSByte) + 1 register format.
+func decodeTimeout(reg uint16) uint16 {
+	return uint16(reg&0x00FF)<<(reg>>8) + 1
+}
+
+func encodeTimeout(mclks uint32) uint16 {
+	if mclks == 0 {
+		return 0
+	}
+	ls := mclks - 1
+	ms := uint16(0)
+	for ls&0xFFFFFF00 > 0 {
+		ls >>= 1
+		ms++
+	}
+	return ms<<8 | uint16(ls&0xFF)
+}
+
+// defaultTuningSettings are the register values of the ST API vl53l0x_tuning.h.
+var defaultTuningSettings = [][2]uint8{
+	{0xFF, 0x01}, {0x00, 0x00},
+	{0xFF, 0x00}, {0x09, 0x00}, {0x10, 0x00}, {0x11, 0x00},
+	{0x24, 0x01}, {0x25, 0xFF}, {0x75, 0x00},
+	{0xFF, 0x01}, {0x4E, 0x2C}, {0x48, 0x00}, {0x30, 0x20},
+	{0xFF, 0x00}, {0x30, 0x09}, {0x54, 0x00}, {0x31, 0x04}, {0x32, 0x03},
+	{0x40, 0x83}, {0x46, 0x25}, {0x60, 0x00}, {0x27, 0x00}, {0x50, 0x06},
+	{0x51, 0x00}, {0x52, 0x96}, {0x56, 0x08}, {0x57, 0x30}, {0x61, 0x00},
+	{0x62, 0x00}, {0x64, 0x00}, {0x65, 0x00}, {0x66, 0xA0},
+	{0xFF, 0x01}, {0x22, 0x32}, {0x47, 0x14}, {0x49, 0xFF}, {0x4A, 0x00},
+	{0xFF, 0x00}, {0x7A, 0x0A}, {0x7B, 0x00}, {0x78, 0x21},
+	{0xFF, 0x01}, {0x23, 0x34}, {0x42, 0x00}, {0x44, 0xFF}, {0x45, 0x26},
+	{0x46, 0x05}, {0x40, 0x40}, {0x0E, 0x06}, {0x20, 0x1A}, {0x43, 0x40},
+	{0xFF, 0x00}, {0x34, 0x03}, {0x35, 0x44},
+	{0xFF, 0x01}, {0x31, 0x04}, {0x4B, 0x09}, {0x4C, 0x05}, {0x4D, 0x04},
+	{0xFF, 0x00}, {0x44, 0x00}, {0x45, 0x20}, {0x47, 0x08}, {0x48, 0x28},
+	{0x67, 0x00}, {0x70, 0x04}, {0x71, 0x01}, {0x72, 0xFE}, {0x76, 0x00},
+	{0x77, 0x00},
+	{0xFF, 0x01}, {0x0D, 0x01},
+	{0xFF, 0x00}, {0x80, 0x01}, {0x01, 0xF8},
+	{0xFF, 0x01}, {0x8E, 0x01}, {0x00, 0x01}, {0xFF, 0x00}, {0x80, 0x00},
+}
@@ -0,0 +1,200 @@
+package vl53l0x
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"devices/i2cemu"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpiotest"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/host/v3"
+)
+
+func TestTimeoutEncoding(t *testing.T) {
+	for _, mclks := range []uint32{1, 2, 255, 256, 257, 1000, 5000, 65535} {
+		reg := encodeTimeout(mclks)
+		got := uint32(decodeTimeout(reg))
+		// encoding drops low bits of large values
+		if got > mclks || mclks-got > mclks/128 {
+			t.Errorf("decodeTimeout(encodeTimeout(%d)) = %d", mclks, got)
+		}
+	}
+	if p := decodeVcselPeriod(encodeVcselPeriod(14)); p != 14 {
+		t.Errorf("vcsel period round trip = %d, want 14", p)
+	}
+	// 14 PCLKs final range period: macro period 5.36µs
+	us := timeoutMclksToMicroseconds(uint16(timeoutMicrosecondsToMclks(30000, 14)), 14)
+	if us < 29990 || us > 30010 {
+		t.Errorf("30000µs round trip = %dµs", us)
+	}
+}
+
+func TestDecodeRange(t *testing.T) {
+	data := []byte{0x5E, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0x2C}
+	r := decodeRange(data)
+	if r.Distance != 300*physic.MilliMetre {
+		t.Errorf("Distance = %s, want 300mm", r.Distance)
+	}
+	if !r.Status.Valid() || r.Status != RANGE_STATUS_RANGE_COMPLETE {
+		t.Errorf("Status = %s, want %s", r.Status, RANGE_STATUS_RANGE_COMPLETE)
+	}
+	data[0] = byte(RANGE_STATUS_MSRC_NO_TARGET) << 3
+	if r := decodeRange(data); r.Status.Valid() {
+		t.Errorf("Status %s reported valid", r.Status)
+	}
+}
+
+func TestNewMultiArgs(t *testing.T) {
+	// pins start high, NewMulti drives them low first when it uses them
+	pins := []gpio.PinOut{&gpiotest.Pin{N: "XSHUT0", L: gpio.High}, &gpiotest.Pin{N: "XSHUT1", L: gpio.High}}
+	for _, addrs := range [][]uint16{
+		{0x30},
+		{0x30, 0x30},
+		{I2CAddr, 0x30},
+		{0x30, 0x80},
+	} {
+		if _, err := NewMulti(nil, pins, addrs, &DefaultOpts); err == nil {
+			t.Errorf("NewMulti(% x) succeeded", addrs)
+		}
+	}
+	for _, p := range pins {
+		if l := p.(*gpiotest.Pin).L; l != gpio.High {
+			t.Errorf("%s touched on invalid arguments", p)
+		}
+	}
+}
+
+// multiEmu emulates sensors booting at I2CAddr while their XSHUT pin is high
+// and moving when I2C_SLAVE_DEVICE_ADDRESS is written. The moves are logged.
+type multiEmu struct {
+	bus   *i2cemu.Bus
+	pins  []*gpiotest.Pin
+	regs  []*i2cemu.RegisterFile
+	addrs []uint16
+	moves []string
+}
+
+func newMultiEmu(n int) *multiEmu {
+	e := &multiEmu{bus: i2cemu.NewBus()}
+	for i := 0; i < n; i++ {
+		i := i
+		rf := i2cemu.NewRegisterFile()
+		rf.Set(IDENTIFICATION_MODEL_ID, VL53L0X_MODEL_ID)
+		// SPAD info ready and calibrations done at once
+		rf.OnRead(0x83, func(*i2cemu.RegisterFile, byte) byte { return 0x10 })
+		rf.OnRead(RESULT_INTERRUPT_STATUS, func(*i2cemu.RegisterFile, byte) byte { return 0x07 })
+		rf.OnWrite(I2C_SLAVE_DEVICE_ADDRESS, func(_ *i2cemu.RegisterFile, _, v byte) {
+			e.moves = append(e.moves, fmt.Sprintf("%d:0x%02x>0x%02x", i, e.addrs[i], v))
+			e.addrs[i] = uint16(v & 0x7F)
+		})
+		// pins start high, NewMulti must hold them low first
+		e.pins = append(e.pins, &gpiotest.Pin{N: fmt.Sprintf("XSHUT%d", i), L: gpio.High})
+		e.regs = append(e.regs, rf)
+		e.addrs = append(e.addrs, I2CAddr)
+	}
+	for a := uint16(0x01); a <= 0x7F; a++ {
+		a := a
+		e.bus.Attach(a, i2cemu.DeviceFunc(func(w, r []byte) error { return e.tx(a, w, r) }))
+	}
+	return e
+}
+
+func (e *multiEmu) tx(addr uint16, w, r []byte) error {
+	var dev *i2cemu.RegisterFile
+	for i, rf := range e.regs {
+		if e.pins[i].L != gpio.High || e.addrs[i] != addr {
+			continue
+		}
+		if dev != nil {
+			return fmt.Errorf("several sensors answer at 0x%02x", addr)
+		}
+		dev = rf
+	}
+	if dev == nil {
+		return errors.New("no ack")
+	}
+	return dev.Tx(w, r)
+}
+
+func (e *multiEmu) xshut() []gpio.PinOut {
+	pins := make([]gpio.PinOut, len(e.pins))
+	for i, p := range e.pins {
+		pins[i] = p
+	}
+	return pins
+}
+
+func TestNewMulti(t *testing.T) {
+	e := newMultiEmu(3)
+	devs, err := NewMulti(e.bus, e.xshut(), []uint16{0x30, 0x31, I2CAddr}, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprint([]string{"0:0x29>0x30", "1:0x29>0x31"}); fmt.Sprint(e.moves) != want {
+		t.Errorf("moves %v, want %s", e.moves, want)
+	}
+	for i, a := range []uint16{0x30, 0x31, I2CAddr} {
+		if devs[i].GetAddress() != a || e.addrs[i] != a {
+			t.Errorf("sensor %d at 0x%02x, emulated at 0x%02x, want 0x%02x", i, devs[i].GetAddress(), e.addrs[i], a)
+		}
+		if id, err := devs[i].GetModelId(); err != nil || id != VL53L0X_MODEL_ID {
+			t.Errorf("sensor %d GetModelId() = 0x%02x, %v", i, id, err)
+		}
+	}
+
+	// the second sensor does not answer as a VL53L0X, the third one stays in
+	// reset
+	e = newMultiEmu(3)
+	e.regs[1].Set(IDENTIFICATION_MODEL_ID, 0x00)
+	devs, err = NewMulti(e.bus, e.xshut(), []uint16{0x30, 0x31, 0x32}, &DefaultOpts)
+	if err == nil {
+		t.Fatal("NewMulti() with a failed sensor succeeded")
+	}
+	if len(devs) != 1 || devs[0].GetAddress() != 0x30 {
+		t.Errorf("NewMulti() returned %d sensors", len(devs))
+	}
+	if e.pins[2].L != gpio.Low {
+		t.Errorf("%s released after the failure", e.pins[2])
+	}
+}
+
+func TestDev_vl53l0x(t *testing.T) {
+	// Make sure periph is initialized.
+	if _, err := host.Init(); err != nil {
+		t.Skip(err)
+	}
+
+	// Use i2creg I²C bus registry to find the first available I²C bus.
+	b, err := i2creg.Open("")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer b.Close()
+
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	r, err := m.ReadRangeSingle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Printf("single: %s status:%s\n", r.Distance, r.Status)
+	if err := m.StartContinuous(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		r, err := m.ReadRangeContinuous()
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Printf("continuous: %s status:%s\n", r.Distance, r.Status)
+	}
+}
@@ -0,0 +1,97 @@
+package ws15364
+
+import (
+	"fmt"
+
+	"devices/deverr"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/pin"
+)
+
+// First and last PCA9685 channels not wired to the TB6612.
+const (
+	FIRST_SPARE_CHANNEL = 6
+	LAST_SPARE_CHANNEL  = 15
+)
+
+// Pin is a spare PCA9685 channel of the HAT, usable for servos or LEDs.
+//
+// The PWM frequency is shared with the motors, PWM only accepts 0 or the
+// frequency set with SetMoterPwmFrequency, e.g. 50Hz for servos.
+type Pin struct {
+	dev     *Dev
+	channel int
+}
+
+// Pin returns spare channel 6 to 15 as an output pin. Channels 0 to 5 drive
+// the motors and are refused.
+func (dev *Dev) Pin(channel int) (*Pin, error) {
+	if channel < FIRST_SPARE_CHANNEL || channel > LAST_SPARE_CHANNEL {
+		return nil, deverr.Paramf("channel %d is not a spare channel: %d-%d", channel, FIRST_SPARE_CHANNEL, LAST_SPARE_CHANNEL)
+	}
+	return &Pin{dev: dev, channel: channel}, nil
+}
+
+func (p *Pin) String() string {
+	return p.Name()
+}
+
+// Halt sets the output low.
+func (p *Pin) Halt() error {
+	return p.Out(gpio.Low)
+}
+
+func (p *Pin) Name() string {
+	return fmt.Sprintf("WS15364_%x_%d", p.dev.c.Addr, p.channel)
+}
+
+func (p *Pin) Number() int {
+	return p.channel
+}
+
+func (p *Pin) Function() string {
+	return string(p.Func())
+}
+
+func (p *Pin) Func() pin.Func {
+	return gpio.PWM
+}
+
+func (p *Pin) SupportedFuncs() []pin.Func {
+	return []pin.Func{gpio.PWM}
+}
+
+func (p *Pin) SetFunc(f pin.Func) error {
+	if f != gpio.PWM {
+		return deverr.Paramf("function not supported: %s", f)
+	}
+	return nil
+}
+
+// Out sets the channel full on or full off.
+func (p *Pin) Out(l gpio.Level) error {
+	if l == gpio.High {
+		return p.set(_PWM_STEPS)
+	}
+	return p.set(0)
+}
+
+// PWM sets the duty cycle, f must be 0 or the motors PWM frequency.
+func (p *Pin) PWM(duty gpio.Duty, f physic.Frequency) error {
+	if f != 0 && f != p.dev.freq {
+		return deverr.Paramf("frequency %s differs from the motors PWM frequency %s", f, p.dev.freq)
+	}
+	if duty < 0 || duty > gpio.DutyMax {
+		return deverr.Paramf("duty out of range: %s", duty)
+	}
+	return p.set(int((int64(duty)*_PWM_STEPS + int64(gpio.DutyHalf)) / int64(gpio.DutyMax)))
+}
+
+func (p *Pin) set(value int) error {
+	return p.dev.writeChannels(fmt.Sprintf("set channel %d", p.channel), p.channel, value)
+}
+
+var _ gpio.PinOut = &Pin{}
+var _ pin.PinFunc = &Pin{}
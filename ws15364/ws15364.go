@@ -1,9 +1,10 @@
 package ws15364
 
 import (
-	"fmt"
+	"math"
+
+	"devices/deverr"
 
-	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/i2c"
 	"periph.io/x/conn/v3/physic"
 	"periph.io/x/devices/v3/pca9685"
@@ -19,8 +20,19 @@ const (
 	_PWMB_CHANNEL = int(5)
 	_BIN1_CHANNEL = int(3)
 	_BIN2_CHANNEL = int(4)
+
+	_LED0_ON_L = 0x06 // PCA9685 LEDn registers are ON_L, ON_H, OFF_L, OFF_H
+	_LED_FULL  = 0x10 // full on/off bit of ON_H and OFF_H
+	_PWM_STEPS = 4096
 )
 
+// channels of each motor: PWM, IN1, IN2, they are contiguous so that a motor
+// is stopped in one transaction
+var motorChannels = [2][3]int{
+	{_PWMA_CHANNEL, _AIN1_CHANNEL, _AIN2_CHANNEL},
+	{_PWMB_CHANNEL, _BIN1_CHANNEL, _BIN2_CHANNEL},
+}
+
 // Enum motor ID
 type MotorId byte
 
@@ -51,21 +63,23 @@ var DefaultOpts = Opts{
 
 // Dev is an handle to an DFR0592 Motors driver.
 type Dev struct {
-	c i2c.Dev
-	d *pca9685.Dev
+	c    i2c.Dev
+	d    *pca9685.Dev
+	freq physic.Frequency // PWM frequency shared by all channels
+	dir  [2]Direction     // direction set on the inputs, 0 when stopped
 }
 
 // New creates a new driver for CCS811 VOC sensor.
 func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
 	if opts.I2cAddress < 0x01 || opts.I2cAddress > 0x70 {
-		return nil, fmt.Errorf("invalid device address")
+		return nil, deverr.Paramf("invalid device address")
 	}
 
 	dev := &Dev{c: i2c.Dev{Bus: bus, Addr: opts.I2cAddress}}
 	var err error
 	dev.d, err = pca9685.NewI2C(bus, dev.c.Addr)
 	if err != nil {
-		return nil, err
+		return nil, deverr.Bus(dev.c.Addr, "init PCA9685", err)
 	}
 
 	if err := dev.SetMoterPwmFrequency(opts.PwmFreq); err != nil {
@@ -74,10 +88,14 @@ func New(bus i2c.Bus, opts *Opts) (*Dev, error) {
 
 	// init channels
 	if err := dev.d.SetAllPwm(0, 0); err != nil {
+		return nil, deverr.Bus(dev.c.Addr, "init channels", err)
+	}
+	if err := dev.MotorStop(M1); err != nil {
+		return nil, err
+	}
+	if err := dev.MotorStop(M2); err != nil {
 		return nil, err
 	}
-	dev.MotorStop(M1)
-	dev.MotorStop(M2)
 	return dev, nil
 }
 
@@ -90,11 +108,12 @@ func (dev *Dev) Close() {
 
 func (dev *Dev) SetMoterPwmFrequency(frequency int16) error {
 	if frequency < 50 || frequency > 1526 {
-		return fmt.Errorf("frequency out of range: 50-1526")
+		return deverr.Paramf("frequency out of range: 50-1526")
 	}
 	if err := dev.d.SetPwmFreq(physic.Frequency(frequency) * physic.Hertz); err != nil {
-		return err
+		return deverr.Bus(dev.c.Addr, "SetMoterPwmFrequency", err)
 	}
+	dev.freq = physic.Frequency(frequency) * physic.Hertz
 	return nil
 }
 
@@ -102,52 +121,153 @@ func (dev *Dev) SetMoterPwmFrequency(frequency int16) error {
 // id: MotorId          Motor Id M1 or M2
 // direction: Direction Motor orientation, CW (clockwise) or CCW (counterclockwise)
 // speed: float         Motor pwm duty cycle, in range 0 to 100, otherwise no effective
+//
+// The motor never runs the wrong way: a change of direction turns the PWM off
+// first, the TB6612 brakes, then sets the inputs and the PWM. On a bus error
+// the motor is left coasting and the errors of the recovery are returned too.
 func (dev *Dev) MotorMovement(id MotorId, direction Direction, speed float32) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
 	if direction != CW && direction != CCW {
-		return fmt.Errorf("wrond direction parameter")
-	}
-	if speed < 0 || speed > 100 {
-		return fmt.Errorf("speed out of range: 0-100")
-	}
-	s := gpio.Duty((4095.0 / 100.0) * speed)
-	if id == M1 {
-		dev.d.SetPwm(_PWMA_CHANNEL, 0, s)
-		//		dev.d.SetFullOn(_PWMA_CHANNEL)
-		if direction == CW {
-			dev.d.SetFullOff(_AIN1_CHANNEL)
-			dev.d.SetFullOn(_AIN2_CHANNEL)
-		} else {
-			dev.d.SetFullOn(_AIN1_CHANNEL)
-			dev.d.SetFullOff(_AIN2_CHANNEL)
+		return deverr.Paramf("wrong direction parameter")
+	}
+	if speed < 0 || speed > 100 || math.IsNaN(float64(speed)) {
+		return deverr.Paramf("speed out of range: 0-100")
+	}
+	return dev.drive(id, direction, dutyOf(speed))
+}
+
+// Motor stop, the motor coasts, see Brake
+// id: MotorId          Motor Id M1 or M2
+func (dev *Dev) MotorStop(id MotorId) error {
+	return dev.Coast(id)
+}
+
+// SetSpeed sets the signed speed of motor id in percent, from -100 to 100,
+// positive is CW, like MotorMovement. A zero speed short-brakes the motor like
+// Brake.
+func (dev *Dev) SetSpeed(id MotorId, speed float32) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	if speed < -100 || speed > 100 || math.IsNaN(float64(speed)) {
+		return deverr.Paramf("speed out of range: -100-100")
+	}
+	duty := dutyOf(speed)
+	switch {
+	case duty > 0:
+		return dev.drive(id, CW, duty)
+	case duty < 0:
+		return dev.drive(id, CCW, -duty)
+	}
+	return dev.Brake(id)
+}
+
+// Brake shorts the windings of motor id, IN1 and IN2 high, the motor holds
+// against slow external forces.
+func (dev *Dev) Brake(id MotorId) error {
+	return dev.stop(id, _PWM_STEPS, _PWM_STEPS)
+}
+
+// Coast releases motor id, IN1 and IN2 low, the TB6612 outputs are in high
+// impedance and the motor spins freely.
+func (dev *Dev) Coast(id MotorId) error {
+	return dev.stop(id, 0, 0)
+}
+
+func checkId(id MotorId) error {
+	if id != M1 && id != M2 {
+		return deverr.Paramf("wrong motor id")
+	}
+	return nil
+}
+
+// dutyOf converts a speed in percent to PCA9685 steps.
+func dutyOf(speed float32) int {
+	return int(math.Round(float64(speed) * _PWM_STEPS / 100))
+}
+
+func (dev *Dev) drive(id MotorId, dir Direction, duty int) error {
+	chs := motorChannels[id-1]
+	if dev.dir[id-1] != dir {
+		in1, in2 := 0, _PWM_STEPS
+		if dir == CCW {
+			in1, in2 = _PWM_STEPS, 0
+		}
+		// a low PWM brakes whatever the inputs are
+		dev.dir[id-1] = 0
+		if err := dev.writeChannels("turn PWM off", chs[0], 0); err != nil {
+			return dev.recover(id, err)
 		}
-	} else if id == M2 {
-		dev.d.SetPwm(_PWMB_CHANNEL, 0, s)
-		//		dev.d.SetFullOn(_PWMB_CHANNEL)
-		if direction == CW {
-			dev.d.SetFullOff(_BIN1_CHANNEL)
-			dev.d.SetFullOn(_BIN2_CHANNEL)
-		} else {
-			dev.d.SetFullOn(_BIN1_CHANNEL)
-			dev.d.SetFullOff(_BIN2_CHANNEL)
+		if err := dev.writeChannels("set direction", chs[1], in1, in2); err != nil {
+			return dev.recover(id, err)
 		}
-	} else {
-		return fmt.Errorf("wrong motor id")
+		dev.dir[id-1] = dir
+	}
+	if err := dev.writeChannels("set PWM", chs[0], duty); err != nil {
+		return dev.recover(id, err)
 	}
 	return nil
 }
 
-// Motor stop
-// id: MotorId          Motor Id M1 or M2
-func (dev *Dev) MotorStop(id MotorId) error {
+// recover coasts motor id after err.
+func (dev *Dev) recover(id MotorId, err error) error {
+	errs := deverr.Errors{err}
+	errs.Append(dev.Coast(id))
+	return errs.Err()
+}
 
-	if id == M1 {
-		dev.d.SetFullOff(_AIN1_CHANNEL)
-		dev.d.SetFullOff(_AIN2_CHANNEL)
-	} else if id == M2 {
-		dev.d.SetFullOff(_BIN1_CHANNEL)
-		dev.d.SetFullOff(_BIN2_CHANNEL)
-	} else {
-		return fmt.Errorf("wrong motor id")
+// stop turns the PWM off and sets the inputs of motor id in one transaction.
+// If it fails the PWM is turned off alone, the TB6612 brakes with a low PWM.
+func (dev *Dev) stop(id MotorId, in1, in2 int) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	dev.dir[id-1] = 0
+	chs := motorChannels[id-1]
+	first := chs[0]
+	for _, ch := range chs[1:] {
+		if ch < first {
+			first = ch
+		}
+	}
+	values := make([]int, len(chs))
+	for i, v := range []int{0, in1, in2} {
+		values[chs[i]-first] = v
+	}
+	err := dev.writeChannels("stop", first, values...)
+	if err == nil {
+		return nil
+	}
+	errs := deverr.Errors{err}
+	errs.Append(dev.writeChannels("turn PWM off", chs[0], 0))
+	return errs.Err()
+}
+
+// ledRegs returns the LEDn registers of a channel high for value/4096 of the
+// period, using the full on/off bits at the ends of the range.
+func ledRegs(value int) [4]byte {
+	switch {
+	case value <= 0:
+		return [4]byte{0, 0, 0, _LED_FULL}
+	case value >= _PWM_STEPS:
+		return [4]byte{0, _LED_FULL, 0, 0}
+	}
+	return [4]byte{0, 0, byte(value), byte(value >> 8)}
+}
+
+// writeChannels sets the duty of channels from first, in 4096 steps, in one
+// auto-increment transaction.
+func (dev *Dev) writeChannels(op string, first int, values ...int) error {
+	w := make([]byte, 1, 1+4*len(values))
+	w[0] = byte(_LED0_ON_L + 4*first)
+	for _, v := range values {
+		r := ledRegs(v)
+		w = append(w, r[:]...)
+	}
+	if err := dev.c.Tx(w, nil); err != nil {
+		return deverr.Bus(dev.c.Addr, op, err)
 	}
 	return nil
 }
@@ -1,25 +1,32 @@
 package ws15364
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"testing"
 	"time"
 
+	"devices/deverr"
+	"devices/i2cemu"
+	"devices/i2cemu/sim"
+
+	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/physic"
 	"periph.io/x/host/v3"
 )
 
 func TestDev_MotorMovement(t *testing.T) {
 	// Make sure periph is initialized.
 	if _, err := host.Init(); err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 
 	// Use i2creg I²C bus registry to find the first available I²C bus.
 	b, err := i2creg.Open("")
 	if err != nil {
-		log.Fatal(err)
+		t.Skip(err)
 	}
 	defer b.Close()
 
@@ -43,3 +50,226 @@ func TestDev_MotorMovement(t *testing.T) {
 	m.Close()
 
 }
+
+func TestDev_emu(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewPCA9685()
+	b.Attach(I2CAddr, s)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MotorMovement(M1, CW, 50); err != nil {
+		t.Fatal(err)
+	}
+	// pca9685.SetPwmFreq omits the -1 of the datasheet prescale formula,
+	// 1500Hz is output at 25MHz/(4096*5)
+	if f := s.Frequency(); f != sim.PCA9685_OSC/(4096*5) {
+		t.Errorf("PWM frequency = %s, want 1.221kHz", f)
+	}
+	if d := s.Duty(_PWMA_CHANNEL); d < 0.49 || d > 0.51 {
+		t.Errorf("PWMA duty = %f, want 0.5", d)
+	}
+	if s.Duty(_AIN1_CHANNEL) != 0 || s.Duty(_AIN2_CHANNEL) != 1 {
+		t.Errorf("AIN1/AIN2 = %f/%f, want off/on", s.Duty(_AIN1_CHANNEL), s.Duty(_AIN2_CHANNEL))
+	}
+	m.MotorStop(M1)
+	if s.Duty(_AIN1_CHANNEL) != 0 || s.Duty(_AIN2_CHANNEL) != 0 {
+		t.Errorf("M1 not stopped")
+	}
+	if err := m.MotorMovement(3, CW, 50); err == nil {
+		t.Errorf("MotorMovement on motor 3 succeeded")
+	}
+}
+
+// countBus counts the transactions sent to the emulated bus, fail can make
+// transaction n fail and after is called once it is done.
+type countBus struct {
+	*i2cemu.Bus
+	n     int
+	fail  func(n int) error
+	after func()
+}
+
+func (b *countBus) Tx(addr uint16, w, r []byte) error {
+	b.n++
+	if b.fail != nil {
+		if err := b.fail(b.n); err != nil {
+			return err
+		}
+	}
+	err := b.Bus.Tx(addr, w, r)
+	if b.after != nil {
+		b.after()
+	}
+	return err
+}
+
+func TestDev_SetSpeed(t *testing.T) {
+	b := &countBus{Bus: i2cemu.NewBus()}
+	s := sim.NewPCA9685()
+	b.Attach(I2CAddr, s)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(name string, id MotorId, pwm, in1, in2 float64) {
+		t.Helper()
+		chs := motorChannels[id-1]
+		if d := s.Duty(chs[0]); d != pwm {
+			t.Errorf("%s: PWM duty = %f, want %f", name, d, pwm)
+		}
+		if s.Duty(chs[1]) != in1 || s.Duty(chs[2]) != in2 {
+			t.Errorf("%s: IN1/IN2 = %f/%f, want %f/%f", name, s.Duty(chs[1]), s.Duty(chs[2]), in1, in2)
+		}
+	}
+
+	b.n = 0
+	if err := m.SetSpeed(M1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if b.n != 3 {
+		t.Errorf("SetSpeed() from stop used %d transactions, want 3", b.n)
+	}
+	b.n = 0
+	if err := m.SetSpeed(M1, 25); err != nil {
+		t.Fatal(err)
+	}
+	if b.n != 1 {
+		t.Errorf("SetSpeed() in the same direction used %d transactions, want 1", b.n)
+	}
+	check("SetSpeed(M1, 25)", M1, 0.25, 0, 1)
+	if err := m.SetSpeed(M2, -100); err != nil {
+		t.Fatal(err)
+	}
+	check("SetSpeed(M2, -100)", M2, 1, 1, 0)
+	check("M1 unchanged", M1, 0.25, 0, 1)
+
+	if err := m.Brake(M1); err != nil {
+		t.Fatal(err)
+	}
+	check("Brake(M1)", M1, 0, 1, 1)
+	if err := m.SetSpeed(M2, 0); err != nil {
+		t.Fatal(err)
+	}
+	check("SetSpeed(M2, 0)", M2, 0, 1, 1)
+	if err := m.Coast(M2); err != nil {
+		t.Fatal(err)
+	}
+	check("Coast(M2)", M2, 0, 0, 0)
+
+	if err := m.SetSpeed(M1, 101); err == nil {
+		t.Errorf("SetSpeed(101) succeeded")
+	}
+	if err := m.Brake(3); err == nil {
+		t.Errorf("Brake on motor 3 succeeded")
+	}
+}
+
+func TestDev_Pin(t *testing.T) {
+	b := i2cemu.NewBus()
+	s := sim.NewPCA9685()
+	b.Attach(I2CAddr, s)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []int{-1, 0, 5, 16} {
+		if _, err := m.Pin(ch); !errors.Is(err, deverr.ErrParameter) {
+			t.Errorf("Pin(%d) = %v, want a parameter error", ch, err)
+		}
+	}
+	m.SetSpeed(M1, 50)
+	p, err := m.Pin(15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PWM(gpio.DutyHalf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if d := s.Duty(15); d != 0.5 {
+		t.Errorf("PWM(50%%) duty = %f", d)
+	}
+	if err := p.PWM(gpio.DutyHalf, 50*physic.Hertz); err == nil {
+		t.Errorf("PWM at 50Hz succeeded, the motors run at 1500Hz")
+	}
+	if err := p.Out(gpio.High); err != nil || s.Duty(15) != 1 {
+		t.Errorf("Out(High) = %v, duty %f", err, s.Duty(15))
+	}
+	if err := p.Halt(); err != nil || s.Duty(15) != 0 {
+		t.Errorf("Halt() = %v, duty %f", err, s.Duty(15))
+	}
+
+	// servo on the same chip
+	if err := m.SetMoterPwmFrequency(50); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PWM(gpio.DutyMax*3/40, 50*physic.Hertz); err != nil {
+		t.Fatal(err)
+	}
+	if d := s.Duty(15); d != 307.0/4096 {
+		t.Errorf("1.5ms servo pulse duty = %f", d)
+	}
+	if s.Duty(_PWMA_CHANNEL) != 0.5 {
+		t.Errorf("PWMA duty changed to %f", s.Duty(_PWMA_CHANNEL))
+	}
+}
+
+func TestDev_MotorMovement_errors(t *testing.T) {
+	b := &countBus{Bus: i2cemu.NewBus()}
+	s := sim.NewPCA9685()
+	b.Attach(I2CAddr, s)
+	m, err := New(b, &DefaultOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MotorMovement(M1, CW, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	// the motor never runs CCW at the old speed or CW at the new one
+	b.after = func() {
+		pwm, in1, in2 := s.Duty(_PWMA_CHANNEL), s.Duty(_AIN1_CHANNEL), s.Duty(_AIN2_CHANNEL)
+		if pwm != 0 && !(in1 == 0 && in2 == 1 && pwm == 0.5) && !(in1 == 1 && in2 == 0 && pwm == 0.25) {
+			t.Errorf("transaction %d: PWMA %f AIN1 %f AIN2 %f", b.n, pwm, in1, in2)
+		}
+	}
+	if err := m.MotorMovement(M1, CCW, 25); err != nil {
+		t.Fatal(err)
+	}
+	m.MotorMovement(M1, CW, 50)
+	b.after = nil
+
+	// the direction write fails, the motor coasts
+	cause := errors.New("remote I/O error")
+	b.n = 0
+	b.fail = func(n int) error {
+		if n == 2 {
+			return cause
+		}
+		return nil
+	}
+	err = m.MotorMovement(M1, CCW, 25)
+	var be *deverr.BusError
+	if !errors.As(err, &be) || be.Op != "set direction" || !errors.Is(err, cause) {
+		t.Errorf("MotorMovement() = %v, want the direction error", err)
+	}
+	if s.Duty(_PWMA_CHANNEL) != 0 || s.Duty(_AIN1_CHANNEL) != 0 || s.Duty(_AIN2_CHANNEL) != 0 {
+		t.Errorf("motor not coasting after a failure")
+	}
+	b.fail = nil
+	if err := m.MotorMovement(M1, CCW, 25); err != nil || s.Duty(_AIN1_CHANNEL) != 1 {
+		t.Errorf("MotorMovement() after recovery = %v", err)
+	}
+
+	// the bus is down, every error is reported
+	b.fail = func(int) error { return cause }
+	err = m.MotorMovement(M1, CW, 50)
+	var errs deverr.Errors
+	if !errors.As(err, &errs) || len(errs) != 3 || !errors.Is(err, deverr.ErrBus) {
+		t.Errorf("MotorMovement() on a failing bus = %v, want 3 errors", err)
+	}
+	if err := m.MotorStop(M2); !errors.As(err, &errs) || len(errs) != 2 {
+		t.Errorf("MotorStop() on a failing bus = %v, want 2 errors", err)
+	}
+}